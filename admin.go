@@ -0,0 +1,123 @@
+package engineio
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+// SessionInfo is the state of a session shown by admin handler.
+type SessionInfo struct {
+	Id           string    `json:"id"`
+	RemoteAddr   string    `json:"remoteAddr"`
+	Transport    string    `json:"transport"`
+	Upgrading    string    `json:"upgrading,omitempty"`
+	State        string    `json:"state"`
+	CreatedAt    time.Time `json:"createdAt"`
+	LastActivity time.Time `json:"lastActivity"`
+	Age          string    `json:"age"`
+	Idle         string    `json:"idle"`
+	Buffered     int       `json:"buffered"`
+}
+
+type adminHandler struct {
+	server *Server
+}
+
+// NewAdminHandler returns the http.Handler to inspect sessions of server, which are enumerated from its session manager. It should be mounted behind authentication.
+//
+// GET lists sessions as JSON, or the session of query sid. DELETE closes the session of query sid.
+func NewAdminHandler(server *Server) http.Handler {
+	return &adminHandler{
+		server: server,
+	}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sid := r.URL.Query().Get("sid")
+	switch r.Method {
+	case "GET":
+		if sid == "" {
+			writeJSON(w, h.server.sessionInfos())
+			return
+		}
+		conn := h.server.getConn(sid)
+		if conn == nil {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, conn.info())
+	case "DELETE":
+		if sid == "" {
+			http.Error(w, "missing sid", http.StatusBadRequest)
+			return
+		}
+		conn := h.server.getConn(sid)
+		if conn == nil {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		conn.Close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// sessionInfos returns the infos of all sessions in the session manager, the oldest first.
+func (s *Server) sessionInfos() []SessionInfo {
+	var ret []SessionInfo
+	s.serverSessions.Range(func(id string, conn Conn) bool {
+		if c, ok := conn.(*serverConn); ok {
+			ret = append(ret, c.info())
+		}
+		return true
+	})
+	if ret == nil {
+		ret = []SessionInfo{}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+	})
+	return ret
+}
+
+func (s *Server) getConn(sid string) *serverConn {
+	c, _ := s.serverSessions.Get(sid).(*serverConn)
+	return c
+}
+
+func (c *serverConn) info() SessionInfo {
+	c.transportLocker.RLock()
+	current, currentName, upgradingName := c.current, c.currentName, c.upgradingName
+	c.transportLocker.RUnlock()
+
+	now := time.Now()
+	lastActivity := c.stats.snapshot(currentName).LastPacketAt
+	if lastActivity.IsZero() {
+		lastActivity = c.createdAt
+	}
+	ret := SessionInfo{
+		Id:           c.id,
+		RemoteAddr:   c.request.RemoteAddr,
+		Transport:    currentName,
+		Upgrading:    upgradingName,
+		State:        c.getState().String(),
+		CreatedAt:    c.createdAt,
+		LastActivity: lastActivity,
+		Age:          now.Sub(c.createdAt).String(),
+		Idle:         now.Sub(lastActivity).String(),
+	}
+	if b, ok := current.(transport.BufferedServer); ok {
+		ret.Buffered = b.Buffered()
+	}
+	return ret
+}
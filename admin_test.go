@@ -0,0 +1,100 @@
+package engineio
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAdminHandler(t *testing.T) {
+	Convey("Admin handler", t, func() {
+		server, h := newEchoServer()
+		defer h.Close()
+		events := newHookEvents(server)
+		admin := NewAdminHandler(server)
+
+		conn, err := Dial(h.URL, &DialOptions{DisableUpgrades: true})
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		<-events.connections
+
+		serve := func(method, sid string) *httptest.ResponseRecorder {
+			resp := httptest.NewRecorder()
+			admin.ServeHTTP(resp, httptest.NewRequest(method, "/?sid="+sid, nil))
+			return resp
+		}
+
+		Convey("list sessions", func() {
+			resp := serve("GET", "")
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Content-Type"), ShouldEqual, "application/json")
+			var infos []SessionInfo
+			So(json.NewDecoder(resp.Body).Decode(&infos), ShouldBeNil)
+			So(len(infos), ShouldEqual, 1)
+			So(infos[0].Id, ShouldEqual, conn.Id())
+			So(infos[0].Transport, ShouldEqual, "polling")
+			So(infos[0].State, ShouldEqual, "normal")
+			So(infos[0].RemoteAddr, ShouldNotBeEmpty)
+			So(infos[0].CreatedAt.IsZero(), ShouldBeFalse)
+			So(infos[0].LastActivity.Before(infos[0].CreatedAt), ShouldBeFalse)
+		})
+
+		Convey("get session", func() {
+			resp := serve("GET", conn.Id())
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			var info SessionInfo
+			So(json.NewDecoder(resp.Body).Decode(&info), ShouldBeNil)
+			So(info.Id, ShouldEqual, conn.Id())
+
+			So(serve("GET", "unknown").Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("force close session", func() {
+			So(serve("DELETE", "unknown").Code, ShouldEqual, http.StatusNotFound)
+			So(serve("DELETE", "").Code, ShouldEqual, http.StatusBadRequest)
+			So(serve("PUT", conn.Id()).Code, ShouldEqual, http.StatusMethodNotAllowed)
+
+			So(serve("DELETE", conn.Id()).Code, ShouldEqual, http.StatusNoContent)
+			So(events.disconnect(), ShouldEqual, ReasonServerClose)
+			So(serve("GET", conn.Id()).Code, ShouldEqual, http.StatusNotFound)
+		})
+	})
+	Convey("Sessions of session manager", t, func() {
+		sessions := newServerSessions()
+		server, err := NewServerWithOptions(WithSessionManager(sessions))
+		So(err, ShouldBeNil)
+		go func() {
+			for {
+				if _, err := server.Accept(); err != nil {
+					return
+				}
+			}
+		}()
+		defer server.Shutdown(context.Background())
+		admin := NewAdminHandler(server)
+		list := func() []SessionInfo {
+			resp := httptest.NewRecorder()
+			admin.ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+			var infos []SessionInfo
+			So(json.NewDecoder(resp.Body).Decode(&infos), ShouldBeNil)
+			return infos
+		}
+
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, newOpenReq())
+		sid := extractSid(resp.Body)
+		infos := list()
+		So(len(infos), ShouldEqual, 1)
+		So(infos[0].Id, ShouldEqual, sid)
+
+		sessions.Remove(sid)
+		So(list(), ShouldBeEmpty)
+		resp = httptest.NewRecorder()
+		admin.ServeHTTP(resp, httptest.NewRequest("GET", "/?sid="+sid, nil))
+		So(resp.Code, ShouldEqual, http.StatusNotFound)
+	})
+}
@@ -0,0 +1,111 @@
+package engineio
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teltechsystems/go-engine.io/cluster"
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+)
+
+// broadcastWorkers is the max number of connections which Broadcast writes to at the same time.
+const broadcastWorkers = 64
+
+// BroadcastError is the error of Broadcast, with the errors of connections which it fails to write to, by session id.
+type BroadcastError map[string]error
+
+func (e BroadcastError) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	errs := make([]string, len(ids))
+	for i, id := range ids {
+		errs[i] = fmt.Sprintf("%s: %s", id, e[id])
+	}
+	return fmt.Sprintf("broadcast failed on %d connections: %s", len(e), strings.Join(errs, "; "))
+}
+
+// Broadcast sends payload as a message of messageType to every session for which filter returns true, or to all sessions if filter is nil.
+//
+// The payload is encoded once for each wire format. Connections are written concurrently, so a slow connection doesn't block the others, and like NextWriter each write waits for upgrading at most 1.5s. A websocket write which peer doesn't read in 1.5s fails, and its connection is closed. It returns BroadcastError if some writes fail, after all writes finish.
+//
+// If server has a broker and filter is nil, the message is also published to other nodes, which send it to all their sessions. filter can't be sent to other nodes, so a filtered broadcast only reaches sessions of this server.
+func (s *Server) Broadcast(messageType MessageType, payload []byte, filter func(Conn) bool) error {
+	err := s.broadcastLocal(messageType, payload, filter)
+	if filter == nil {
+		if perr := s.publish(cluster.ToAll, "", messageType, payload); err == nil {
+			err = perr
+		}
+	}
+	return err
+}
+
+func (s *Server) broadcastLocal(messageType MessageType, payload []byte, filter func(Conn) bool) error {
+	return fanOut(messageType, payload, func(f func(id string, conn Conn) bool) {
+		s.serverSessions.Range(func(id string, conn Conn) bool {
+			if filter != nil && !filter(conn) {
+				return true
+			}
+			return f(id, conn)
+		})
+	})
+}
+
+// fanOut writes payload to each connection which each iterates, with at most broadcastWorkers writes at the same time.
+func fanOut(messageType MessageType, payload []byte, each func(f func(id string, conn Conn) bool)) error {
+	packet := parser.NewPreparedPacket(message.MessageType(messageType), parser.MESSAGE, payload)
+
+	var locker sync.Mutex
+	errs := BroadcastError{}
+	wg := sync.WaitGroup{}
+	workers := make(chan struct{}, broadcastWorkers)
+	each(func(id string, conn Conn) bool {
+		workers <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			if err := broadcastTo(conn, packet); err != nil {
+				locker.Lock()
+				errs[id] = err
+				locker.Unlock()
+			}
+		}()
+		return true
+	})
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func broadcastTo(conn Conn, packet *parser.PreparedPacket) error {
+	c, ok := conn.(*serverConn)
+	if !ok {
+		return writeMessage(conn, MessageType(packet.MessageType()), packet.Data())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	err := c.writePrepared(ctx, packet)
+	if err == context.DeadlineExceeded {
+		return fmt.Errorf("upgrading")
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		// a timed out websocket can't be written any more.
+		c.Close()
+		return fmt.Errorf("write timeout")
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package engineio
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/transport"
+	"github.com/teltechsystems/go-engine.io/websocket"
+)
+
+func TestBroadcast(t *testing.T) {
+	Convey("Broadcast", t, func() {
+		server, h := newEchoServer()
+		defer h.Close()
+
+		wsOnly := []transport.Creater{websocket.Creater}
+		clients := map[string]struct {
+			url  string
+			opts *DialOptions
+		}{
+			"v4 polling":     {h.URL, &DialOptions{DisableUpgrades: true}},
+			"v4 websocket":   {h.URL, &DialOptions{Transports: wsOnly}},
+			"v3 polling":     {h.URL, &DialOptions{Protocol: 3, DisableUpgrades: true}},
+			"v3 b64 polling": {h.URL + "/?b64=1", &DialOptions{Protocol: 3, DisableUpgrades: true}},
+			"v3 websocket":   {h.URL, &DialOptions{Protocol: 3, Transports: wsOnly}},
+			"excluded":       {h.URL, &DialOptions{DisableUpgrades: true}},
+		}
+		conns := map[string]Conn{}
+		for name, c := range clients {
+			conn, err := Dial(c.url, c.opts)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			conns[name] = conn
+		}
+		So(server.Sessions().Len(), ShouldEqual, len(clients))
+
+		excluded := conns["excluded"].Id()
+		filter := func(conn Conn) bool {
+			return conn.Id() != excluded
+		}
+		So(server.Broadcast(MessageText, []byte("hello"), filter), ShouldBeNil)
+		So(server.Broadcast(MessageBinary, []byte{0, 1, 2}, filter), ShouldBeNil)
+
+		for name, conn := range conns {
+			if name == "excluded" {
+				ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+				_, _, err := conn.(ContextConn).NextReaderContext(ctx)
+				cancel()
+				So(err, ShouldResemble, context.DeadlineExceeded)
+				continue
+			}
+			for _, expect := range []struct {
+				t    MessageType
+				data []byte
+			}{{MessageText, []byte("hello")}, {MessageBinary, []byte{0, 1, 2}}} {
+				typ, r, err := conn.NextReader()
+				So(err, ShouldBeNil)
+				b, err := ioutil.ReadAll(r)
+				r.Close()
+				So(err, ShouldBeNil)
+				So(typ, ShouldEqual, expect.t)
+				So(b, ShouldResemble, expect.data)
+			}
+		}
+	})
+
+	Convey("Peer which doesn't read", t, func() {
+		server, err := NewServerWithOptions(WithPingInterval(time.Minute), WithPingTimeout(2*time.Minute))
+		So(err, ShouldBeNil)
+		go func() {
+			for {
+				if _, err := server.Accept(); err != nil {
+					return
+				}
+			}
+		}()
+		h := httptest.NewServer(server)
+		defer h.Close()
+		defer server.Shutdown(context.Background())
+
+		ws, _, err := gorilla.DefaultDialer.Dial("ws"+strings.TrimPrefix(h.URL, "http")+"/?EIO=4&transport=websocket", nil)
+		So(err, ShouldBeNil)
+		defer ws.Close()
+		for server.Count() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		// larger than socket buffers, so the write blocks.
+		payload := make([]byte, 32<<20)
+		start := time.Now()
+		err = server.Broadcast(MessageBinary, payload, nil)
+		So(time.Since(start), ShouldBeLessThan, 5*time.Second)
+		berr, ok := err.(BroadcastError)
+		So(ok, ShouldBeTrue)
+		So(len(berr), ShouldEqual, 1)
+		for _, err := range berr {
+			So(err.Error(), ShouldEqual, "write timeout")
+		}
+
+		// the timed out connection is closed.
+		for server.Count() > 0 && time.Since(start) < 5*time.Second {
+			time.Sleep(10 * time.Millisecond)
+		}
+		So(server.Count(), ShouldEqual, 0)
+	})
+
+	Convey("Broadcast error", t, func() {
+		err := BroadcastError{
+			"b": errors.New("closed"),
+			"a": errors.New("upgrading"),
+		}
+		So(err.Error(), ShouldEqual, "broadcast failed on 2 connections: a: upgrading; b: closed")
+	})
+}
@@ -0,0 +1,102 @@
+package engineio
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/teltechsystems/go-engine.io/cluster"
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+)
+
+var ErrSessionNotFound = errors.New("engine.io: session not found")
+
+// brokerLink is the broker of server, with the node id which server publishes as, and the subscription of it.
+type brokerLink struct {
+	node        string
+	broker      cluster.Broker
+	unsubscribe func()
+}
+
+// SetBroker joins server to a cluster of nodes sharing broker. Broadcast, Rooms.Send and SendTo publish messages to other nodes, and server delivers messages published by them to its own sessions. It should be called before serving.
+func (s *Server) SetBroker(broker cluster.Broker) error {
+	s.mustMutate("SetBroker")
+	return s.setBroker(broker)
+}
+
+func (s *Server) setBroker(broker cluster.Broker) error {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	node := hex.EncodeToString(b)
+	unsubscribe, err := broker.Subscribe(func(e *cluster.Envelope) {
+		s.onEnvelope(node, e)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.brokerLocker.Lock()
+	defer s.brokerLocker.Unlock()
+	if old := s.getBroker(); old != nil {
+		old.unsubscribe()
+	}
+	s.broker.Store(&brokerLink{
+		node:        node,
+		broker:      broker,
+		unsubscribe: unsubscribe,
+	})
+	return nil
+}
+
+// getBroker returns the broker of server, or nil if server has no broker.
+func (s *Server) getBroker() *brokerLink {
+	ret, _ := s.broker.Load().(*brokerLink)
+	return ret
+}
+
+// SendTo sends payload as a message of messageType to the session sid. If the session isn't on this server, it's published to other nodes by broker, and returns ErrSessionNotFound if server has no broker.
+func (s *Server) SendTo(sid string, messageType MessageType, payload []byte) error {
+	if conn := s.serverSessions.Get(sid); conn != nil {
+		return broadcastTo(conn, parser.NewPreparedPacket(message.MessageType(messageType), parser.MESSAGE, payload))
+	}
+	if s.getBroker() == nil {
+		return ErrSessionNotFound
+	}
+	return s.publish(cluster.ToSession, sid, messageType, payload)
+}
+
+// publish sends the message to other nodes, if server has a broker.
+func (s *Server) publish(target cluster.Target, to string, messageType MessageType, payload []byte) error {
+	b := s.getBroker()
+	if b == nil {
+		return nil
+	}
+	return b.broker.Publish(&cluster.Envelope{
+		Node:        b.node,
+		Target:      target,
+		To:          to,
+		MessageType: message.MessageType(messageType),
+		Payload:     payload,
+	})
+}
+
+// onEnvelope delivers the message published by other nodes to sessions of this server, which subscribes as node. Errors are dropped, since the publisher doesn't wait for them.
+func (s *Server) onEnvelope(node string, e *cluster.Envelope) {
+	if e.Node == node {
+		return
+	}
+	t := MessageType(e.MessageType)
+	switch e.Target {
+	case cluster.ToAll:
+		s.broadcastLocal(t, e.Payload, nil)
+	case cluster.ToRoom:
+		s.rooms.sendLocal(e.To, t, e.Payload)
+	case cluster.ToSession:
+		if conn := s.serverSessions.Get(e.To); conn != nil {
+			broadcastTo(conn, parser.NewPreparedPacket(e.MessageType, parser.MESSAGE, e.Payload))
+		}
+	}
+}
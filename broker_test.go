@@ -0,0 +1,93 @@
+package engineio
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/cluster"
+)
+
+func TestBroker(t *testing.T) {
+	Convey("Cluster of servers", t, func() {
+		hub, err := cluster.ListenTCPHub("127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer hub.Close()
+
+		rooms := NewMemoryRooms()
+		nodes := make([]*Server, 2)
+		clients := make([]Conn, 2)
+		for i := range nodes {
+			server, h := newEchoServer()
+			defer h.Close()
+			events := newHookEvents(server)
+			broker, err := cluster.DialTCP(hub.Addr())
+			So(err, ShouldBeNil)
+			defer broker.Close()
+			So(server.SetBroker(broker), ShouldBeNil)
+			server.SetRoomsBackend(rooms)
+			nodes[i] = server
+
+			clients[i], err = Dial(h.URL, &DialOptions{DisableUpgrades: true})
+			So(err, ShouldBeNil)
+			defer clients[i].Close()
+			So(server.Rooms().Join(<-events.connections, "lobby"), ShouldBeNil)
+		}
+
+		read := func(conn Conn) string {
+			_, r, err := conn.NextReader()
+			So(err, ShouldBeNil)
+			b, _ := ioutil.ReadAll(r)
+			r.Close()
+			return string(b)
+		}
+
+		Convey("send to session of other node", func() {
+			So(nodes[0].SendTo(clients[1].Id(), MessageText, []byte("remote")), ShouldBeNil)
+			So(read(clients[1]), ShouldEqual, "remote")
+			So(nodes[0].SendTo(clients[0].Id(), MessageText, []byte("local")), ShouldBeNil)
+			So(read(clients[0]), ShouldEqual, "local")
+		})
+
+		Convey("broadcast to all nodes", func() {
+			So(nodes[1].Broadcast(MessageText, []byte("all"), nil), ShouldBeNil)
+			So(read(clients[0]), ShouldEqual, "all")
+			So(read(clients[1]), ShouldEqual, "all")
+		})
+
+		Convey("send to room of all nodes", func() {
+			So(nodes[0].Rooms().Send("lobby", MessageBinary, []byte("room")), ShouldBeNil)
+			So(read(clients[0]), ShouldEqual, "room")
+			So(read(clients[1]), ShouldEqual, "room")
+		})
+	})
+
+	Convey("Failed SetBroker keeps the current broker", t, func() {
+		server, _ := NewServer(nil)
+		broker := cluster.NewMemoryBroker()
+		So(server.SetBroker(broker), ShouldBeNil)
+		current := server.getBroker()
+
+		So(server.SetBroker(failBroker{}), ShouldEqual, errSubscribe)
+		So(server.getBroker(), ShouldEqual, current)
+		So(server.SendTo("unknown", MessageText, nil), ShouldBeNil)
+	})
+
+	Convey("Send to unknown session without broker", t, func() {
+		server, _ := NewServer(nil)
+		So(server.SendTo("unknown", MessageText, nil), ShouldEqual, ErrSessionNotFound)
+	})
+}
+
+var errSubscribe = errors.New("subscribe failed")
+
+type failBroker struct{}
+
+func (failBroker) Publish(e *cluster.Envelope) error {
+	return nil
+}
+
+func (failBroker) Subscribe(handler func(e *cluster.Envelope)) (func(), error) {
+	return nil, errSubscribe
+}
@@ -0,0 +1,516 @@
+package engineio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/polling"
+	"github.com/teltechsystems/go-engine.io/transport"
+	"github.com/teltechsystems/go-engine.io/websocket"
+)
+
+var HandshakeError = errors.New("invalid handshake")
+
+// DialOptions is the options of Dial.
+type DialOptions struct {
+
+	// Transports are the transports which client uses. The first one is used to handshake, others are upgraded to if server allows. Default is polling and websocket.
+	Transports []transport.Creater
+
+	// Header is the extra header sent with every request.
+	Header http.Header
+
+	// Protocol is the revision of engine.io protocol. Default is 4.
+	Protocol int
+
+	// DisableUpgrades disables upgrading from the handshake transport.
+	DisableUpgrades bool
+}
+
+type handshakeInfo struct {
+	Sid          string   `json:"sid"`
+	Upgrades     []string `json:"upgrades"`
+	PingInterval int64    `json:"pingInterval"`
+	PingTimeout  int64    `json:"pingTimeout"`
+	MaxPayload   int64    `json:"maxPayload"`
+}
+
+type clientConn struct {
+	id              string
+	request         *http.Request
+	url             url.URL
+	header          http.Header
+	creaters        []transport.Creater
+	protocol        int
+	upgrades        []string
+	writerLocker    sync.Mutex
+	transportLocker sync.RWMutex
+	currentName     string
+	current         transport.Client
+	state           state
+	stateLocker     sync.RWMutex
+	readerChan      chan *connReader
+	pingInterval    time.Duration
+	pingTimeout     time.Duration
+	pingChan        chan bool
+	closeChan       chan struct{}
+	closeOnce       sync.Once
+	reason          DisconnectReason
+	reasonSet       bool
+	err             error
+	stats           connStats
+}
+
+// Dial connects to the engine.io server at url u. If opts is nil, it uses protocol v4, handshakes with polling and upgrades to websocket.
+func Dial(u string, opts *DialOptions) (Conn, error) {
+	if opts == nil {
+		opts = &DialOptions{}
+	}
+	target, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	creaters := opts.Transports
+	if len(creaters) == 0 {
+		creaters = []transport.Creater{polling.Creater, websocket.Creater}
+	}
+	protocol := opts.Protocol
+	if protocol == 0 {
+		protocol = parser.ProtocolV4
+	}
+	if protocol != parser.ProtocolV3 && protocol != parser.ProtocolV4 {
+		return nil, ProtocolError
+	}
+	ret := &clientConn{
+		url:        *target,
+		header:     opts.Header,
+		creaters:   creaters,
+		protocol:   protocol,
+		state:      stateNormal,
+		readerChan: make(chan *connReader),
+		pingChan:   make(chan bool, 1),
+		closeChan:  make(chan struct{}),
+	}
+	if err := ret.handshake(creaters[0]); err != nil {
+		return nil, err
+	}
+
+	go ret.pingLoop()
+	if !opts.DisableUpgrades {
+		go ret.upgrade()
+	}
+
+	return ret, nil
+}
+
+func (c *clientConn) Id() string {
+	return c.id
+}
+
+func (c *clientConn) Request() *http.Request {
+	return c.request
+}
+
+func (c *clientConn) Err() error {
+	c.stateLocker.RLock()
+	defer c.stateLocker.RUnlock()
+	if c.state != stateClosed {
+		return nil
+	}
+	return &CloseError{
+		Reason: c.reason,
+		Err:    c.err,
+	}
+}
+
+func (c *clientConn) CloseReason() DisconnectReason {
+	c.stateLocker.RLock()
+	defer c.stateLocker.RUnlock()
+	return c.reason
+}
+
+func (c *clientConn) Stats() Stats {
+	return c.stats.snapshot(c.getCurrentName())
+}
+
+func (c *clientConn) NextReader() (MessageType, io.ReadCloser, error) {
+	return c.NextReaderContext(context.Background())
+}
+
+func (c *clientConn) NextReaderContext(ctx context.Context) (MessageType, io.ReadCloser, error) {
+	select {
+	case ret := <-c.readerChan:
+		return MessageType(ret.MessageType()), ret, nil
+	case <-c.closeChan:
+		return MessageBinary, nil, io.EOF
+	case <-ctx.Done():
+		return MessageBinary, nil, ctx.Err()
+	}
+}
+
+func (c *clientConn) NextWriter(t MessageType) (io.WriteCloser, error) {
+	return c.NextWriterContext(context.Background(), t)
+}
+
+func (c *clientConn) NextWriterContext(ctx context.Context, t MessageType) (io.WriteCloser, error) {
+	if c.getState() != stateNormal {
+		return nil, io.EOF
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.writerLocker.Lock()
+	ret, err := c.getCurrent().NextWriter(message.MessageType(t), parser.MESSAGE)
+	if err != nil {
+		c.writerLocker.Unlock()
+		return ret, err
+	}
+	writer := newConnWriter(c.stats.writer(ret, t, parser.MESSAGE), &c.writerLocker)
+	return writer, err
+}
+
+func (c *clientConn) Close() error {
+	if c.getState() != stateNormal {
+		return nil
+	}
+	c.setReason(ReasonClientClose, nil)
+	c.writerLocker.Lock()
+	if w, err := c.getCurrent().NextWriter(message.MessageText, parser.CLOSE); err == nil {
+		writer := newConnWriter(c.stats.writer(w, MessageText, parser.CLOSE), &c.writerLocker)
+		writer.Close()
+	} else {
+		c.writerLocker.Unlock()
+	}
+	c.onClose()
+	return nil
+}
+
+func (c *clientConn) newRequest(transportName string) (*http.Request, error) {
+	u := c.url
+	query := u.Query()
+	query.Set("EIO", strconv.Itoa(c.protocol))
+	query.Set("transport", transportName)
+	if c.id != "" {
+		query.Set("sid", c.id)
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+func (c *clientConn) handshake(creater transport.Creater) error {
+	req, err := c.newRequest(creater.Name)
+	if err != nil {
+		return err
+	}
+	t, err := creater.Client(req)
+	if err != nil {
+		return err
+	}
+	decoder, err := t.NextReader()
+	if err != nil {
+		t.Close()
+		return err
+	}
+	var info handshakeInfo
+	if decoder.Type() == parser.OPEN {
+		err = json.NewDecoder(decoder).Decode(&info)
+	}
+	decoder.Close()
+	if decoder.Type() != parser.OPEN || err != nil || info.Sid == "" || info.PingInterval <= 0 {
+		t.Close()
+		return HandshakeError
+	}
+
+	c.id = info.Sid
+	c.request = req
+	c.upgrades = info.Upgrades
+	c.pingInterval = time.Duration(info.PingInterval) * time.Millisecond
+	c.pingTimeout = time.Duration(info.PingTimeout) * time.Millisecond
+
+	var pending []*parser.PacketDecoder
+	if creater.Name == polling.Creater.Name {
+		// polling requests need sid, so drain the rest of handshake response and poll again with sid.
+		t.Close()
+		for {
+			decoder, err := t.NextReader()
+			if err != nil {
+				break
+			}
+			d, err := bufferPacket(decoder)
+			decoder.Close()
+			if err != nil {
+				return err
+			}
+			pending = append(pending, d)
+		}
+		if req, err = c.newRequest(creater.Name); err != nil {
+			return err
+		}
+		if t, err = creater.Client(req); err != nil {
+			return err
+		}
+	}
+	c.setCurrent(creater.Name, t)
+
+	go c.readLoop(t, pending)
+
+	return nil
+}
+
+func (c *clientConn) upgrade() {
+	for _, creater := range c.creaters {
+		if !creater.Upgrading || creater.Name == c.getCurrentName() {
+			continue
+		}
+		for _, name := range c.upgrades {
+			if name != creater.Name {
+				continue
+			}
+			if err := c.probe(creater); err == nil {
+				return
+			}
+		}
+	}
+}
+
+// pauser is implemented by transports which poll, like polling client.
+type pauser interface {
+	Pause()
+	Resume()
+}
+
+func (c *clientConn) probe(creater transport.Creater) error {
+	req, err := c.newRequest(creater.Name)
+	if err != nil {
+		return err
+	}
+	t, err := creater.Client(req)
+	if err != nil {
+		return err
+	}
+	// server flushes the pending poll when probed, pause polling so no poll is sent after server switches transport.
+	if p, ok := c.getCurrent().(pauser); ok {
+		p.Pause()
+		defer p.Resume()
+	}
+	w, err := t.NextWriter(message.MessageText, parser.PING)
+	if err == nil {
+		w.Write([]byte("probe"))
+		err = w.Close()
+	}
+	if err != nil {
+		t.Close()
+		return err
+	}
+	decoder, err := t.NextReader()
+	if err != nil {
+		t.Close()
+		return err
+	}
+	b, err := ioutil.ReadAll(decoder)
+	decoder.Close()
+	if decoder.Type() != parser.PONG || string(b) != "probe" || err != nil {
+		t.Close()
+		return HandshakeError
+	}
+
+	c.writerLocker.Lock()
+	defer c.writerLocker.Unlock()
+
+	if c.getState() != stateNormal {
+		t.Close()
+		return io.EOF
+	}
+	old := c.getCurrent()
+	c.setCurrent(creater.Name, t)
+	// stop polling before upgrading, or it may poll again after server drops it.
+	old.Close()
+	w, err = t.NextWriter(message.MessageText, parser.UPGRADE)
+	if err == nil {
+		err = c.stats.writer(w, MessageText, parser.UPGRADE).Close()
+	}
+	if err != nil {
+		c.setReason(ReasonUpgradeError, err)
+		go c.onClose()
+		return err
+	}
+
+	c.stats.onUpgrade()
+	go c.readLoop(t, nil)
+
+	return nil
+}
+
+func (c *clientConn) readLoop(t transport.Client, pending []*parser.PacketDecoder) {
+	for _, decoder := range pending {
+		c.onPacket(t, decoder)
+	}
+	for {
+		decoder, err := t.NextReader()
+		if err != nil {
+			if c.getCurrent() == t {
+				if err != io.EOF {
+					c.setReason(ReasonTransportError, err)
+				}
+				c.onClose()
+			}
+			return
+		}
+		c.onPacket(t, decoder)
+		decoder.Close()
+	}
+}
+
+func (c *clientConn) onPacket(t transport.Client, r *parser.PacketDecoder) {
+	c.stats.onReceive(r)
+	switch r.Type() {
+	case parser.PING:
+		c.writerLocker.Lock()
+		if w, _ := t.NextWriter(message.MessageText, parser.PONG); w != nil {
+			w = c.stats.writer(w, MessageText, parser.PONG)
+			n, _ := io.Copy(w, r)
+			c.stats.addBytesIn(n)
+			w.Close()
+		}
+		c.writerLocker.Unlock()
+		fallthrough
+	case parser.PONG:
+		select {
+		case c.pingChan <- true:
+		default:
+		}
+	case parser.MESSAGE:
+		closeChan := make(chan struct{})
+		reader := newConnReader(r, closeChan)
+		reader.stats = &c.stats
+		select {
+		case c.readerChan <- reader:
+			<-closeChan
+		case <-c.closeChan:
+		}
+	case parser.CLOSE:
+		c.setReason(ReasonServerClose, nil)
+		c.onClose()
+	}
+}
+
+func (c *clientConn) onClose() {
+	c.closeOnce.Do(func() {
+		c.setState(stateClosed)
+		close(c.closeChan)
+		c.getCurrent().Close()
+	})
+}
+
+func (c *clientConn) pingLoop() {
+	timeout := c.pingInterval + c.pingTimeout
+	lastPing := time.Now()
+	lastTry := lastPing
+	for {
+		now := time.Now()
+		pingDiff := now.Sub(lastPing)
+		tryDiff := now.Sub(lastTry)
+		select {
+		case <-c.closeChan:
+			return
+		case <-c.pingChan:
+			lastPing = time.Now()
+			lastTry = lastPing
+		case <-time.After(c.pingInterval - tryDiff):
+			if c.protocol == parser.ProtocolV3 {
+				// client pings server in protocol v3.
+				c.writerLocker.Lock()
+				if w, _ := c.getCurrent().NextWriter(message.MessageText, parser.PING); w != nil {
+					c.stats.writer(w, MessageText, parser.PING).Close()
+				}
+				c.writerLocker.Unlock()
+			}
+			lastTry = time.Now()
+		case <-time.After(timeout - pingDiff):
+			c.setReason(ReasonPingTimeout, nil)
+			c.Close()
+			return
+		}
+	}
+}
+
+func (c *clientConn) getCurrent() transport.Client {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+
+	return c.current
+}
+
+func (c *clientConn) getCurrentName() string {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+
+	return c.currentName
+}
+
+func (c *clientConn) setCurrent(name string, t transport.Client) {
+	c.transportLocker.Lock()
+	defer c.transportLocker.Unlock()
+
+	c.currentName = name
+	c.current = t
+}
+
+// setReason sets the reason and error of disconnection if they aren't set yet.
+func (c *clientConn) setReason(reason DisconnectReason, err error) {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	if !c.reasonSet {
+		c.reason = reason
+		c.reasonSet = true
+		c.err = err
+	}
+}
+
+func (c *clientConn) getState() state {
+	c.stateLocker.RLock()
+	defer c.stateLocker.RUnlock()
+	return c.state
+}
+
+func (c *clientConn) setState(state state) {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	c.state = state
+}
+
+// bufferPacket reads the whole packet of decoder d, and returns a new decoder of it which doesn't depend on the underlying reader.
+func bufferPacket(d *parser.PacketDecoder) (*parser.PacketDecoder, error) {
+	newEncoder := parser.NewStringEncoder
+	if d.MessageType() == message.MessageBinary {
+		newEncoder = parser.NewBinaryEncoder
+	}
+	buf := bytes.NewBuffer(nil)
+	w, err := newEncoder(buf, d.Type())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(w, d); err != nil {
+		return nil, err
+	}
+	w.Close()
+	return parser.NewDecoder(buf)
+}
@@ -0,0 +1,138 @@
+package engineio
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+	"github.com/teltechsystems/go-engine.io/websocket"
+)
+
+func newEchoServer() (*Server, *httptest.Server) {
+	server, _ := NewServer(nil)
+	server.SetPingInterval(time.Second / 2)
+	server.SetPingTimeout(time.Second)
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					t, r, err := conn.NextReader()
+					if err != nil {
+						return
+					}
+					b, _ := ioutil.ReadAll(r)
+					r.Close()
+					w, err := conn.NextWriter(t)
+					if err != nil {
+						return
+					}
+					w.Write(b)
+					w.Close()
+				}
+			}()
+		}
+	}()
+	return server, httptest.NewServer(server)
+}
+
+func echo(conn Conn, t MessageType, data string) (MessageType, string) {
+	w, err := conn.NextWriter(t)
+	So(err, ShouldBeNil)
+	w.Write([]byte(data))
+	So(w.Close(), ShouldBeNil)
+
+	rt, r, err := conn.NextReader()
+	So(err, ShouldBeNil)
+	b, err := ioutil.ReadAll(r)
+	So(err, ShouldBeNil)
+	So(r.Close(), ShouldBeNil)
+	return rt, string(b)
+}
+
+func TestDial(t *testing.T) {
+	Convey("Dial", t, func() {
+		server, h := newEchoServer()
+		defer h.Close()
+
+		Convey("with protocol v4 and upgrade", func() {
+			conn, err := Dial(h.URL, nil)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			So(conn.Id(), ShouldNotEqual, "")
+			So(conn.Request().URL.Query().Get("EIO"), ShouldEqual, "4")
+
+			rt, data := echo(conn, MessageText, "hello")
+			So(rt, ShouldEqual, MessageText)
+			So(data, ShouldEqual, "hello")
+
+			time.Sleep(time.Second / 2)
+			So(conn.(*clientConn).getCurrentName(), ShouldEqual, "websocket")
+
+			rt, data = echo(conn, MessageBinary, "\x01\x02")
+			So(rt, ShouldEqual, MessageBinary)
+			So(data, ShouldEqual, "\x01\x02")
+
+			time.Sleep(time.Second * 2)
+			So(server.Count(), ShouldEqual, 1)
+			rt, data = echo(conn, MessageText, "still alive")
+			So(data, ShouldEqual, "still alive")
+		})
+
+		Convey("with protocol v3", func() {
+			conn, err := Dial(h.URL, &DialOptions{
+				Protocol:        parser.ProtocolV3,
+				DisableUpgrades: true,
+			})
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			rt, data := echo(conn, MessageBinary, "测试")
+			So(rt, ShouldEqual, MessageBinary)
+			So(data, ShouldEqual, "测试")
+
+			time.Sleep(time.Second * 2)
+			So(conn.(*clientConn).getCurrentName(), ShouldEqual, "polling")
+			rt, data = echo(conn, MessageText, "still alive")
+			So(data, ShouldEqual, "still alive")
+		})
+
+		Convey("with websocket only", func() {
+			conn, err := Dial(h.URL, &DialOptions{
+				Transports: []transport.Creater{websocket.Creater},
+			})
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			rt, data := echo(conn, MessageText, "hello")
+			So(rt, ShouldEqual, MessageText)
+			So(data, ShouldEqual, "hello")
+		})
+
+		Convey("closed by client", func() {
+			conn, err := Dial(h.URL, nil)
+			So(err, ShouldBeNil)
+			So(conn.Close(), ShouldBeNil)
+			_, _, err = conn.NextReader()
+			So(err, ShouldNotBeNil)
+			_, err = conn.NextWriter(MessageText)
+			So(err, ShouldNotBeNil)
+
+			time.Sleep(time.Second / 2)
+			So(server.Count(), ShouldEqual, 0)
+		})
+
+		Convey("with invalid protocol", func() {
+			_, err := Dial(h.URL, &DialOptions{Protocol: 2})
+			So(err, ShouldEqual, ProtocolError)
+		})
+	})
+}
@@ -0,0 +1,37 @@
+// Package cluster delivers messages to sessions held by other nodes of engine.io servers, through a publish/subscribe Broker.
+package cluster
+
+import (
+	"github.com/teltechsystems/go-engine.io/message"
+)
+
+// Target is the kind of sessions which an envelope is addressed to.
+type Target string
+
+const (
+	// ToAll addresses all sessions.
+	ToAll Target = "all"
+	// ToRoom addresses sessions in the room of Envelope.To.
+	ToRoom Target = "room"
+	// ToSession addresses the session whose id is Envelope.To.
+	ToSession Target = "session"
+)
+
+// Envelope is a message published to all nodes, and each node delivers it to its own sessions which are addressed.
+type Envelope struct {
+	// Node is the id of publishing node, which has delivered it to its own sessions already.
+	Node        string              `json:"node"`
+	Target      Target              `json:"target"`
+	To          string              `json:"to,omitempty"`
+	MessageType message.MessageType `json:"type"`
+	Payload     []byte              `json:"payload"`
+}
+
+// Broker publishes envelopes to all nodes. Methods are called concurrently.
+type Broker interface {
+	// Publish sends e to all subscribers, including the ones of publishing node.
+	Publish(e *Envelope) error
+
+	// Subscribe calls handler with every published envelope in order, until cancel is called. handler shouldn't block for long, or it delays later envelopes.
+	Subscribe(handler func(e *Envelope)) (cancel func(), err error)
+}
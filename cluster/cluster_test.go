@@ -0,0 +1,90 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/message"
+)
+
+func receive(c chan *Envelope) *Envelope {
+	select {
+	case e := <-c:
+		return e
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+func testBroker(b1, b2 Broker) {
+	c1, c2 := make(chan *Envelope, 10), make(chan *Envelope, 10)
+	cancel1, err := b1.Subscribe(func(e *Envelope) { c1 <- e })
+	So(err, ShouldBeNil)
+	cancel2, err := b2.Subscribe(func(e *Envelope) { c2 <- e })
+	So(err, ShouldBeNil)
+	defer cancel2()
+
+	// TCPHub doesn't relay to brokers which aren't accepted yet.
+	time.Sleep(50 * time.Millisecond)
+
+	for i, to := range []string{"a", "b"} {
+		err := b1.Publish(&Envelope{
+			Node:        "1",
+			Target:      ToSession,
+			To:          to,
+			MessageType: message.MessageBinary,
+			Payload:     []byte{byte(i)},
+		})
+		So(err, ShouldBeNil)
+	}
+	for _, c := range []chan *Envelope{c1, c2} {
+		for i, to := range []string{"a", "b"} {
+			e := receive(c)
+			So(e, ShouldNotBeNil)
+			So(e.Node, ShouldEqual, "1")
+			So(e.Target, ShouldEqual, ToSession)
+			So(e.To, ShouldEqual, to)
+			So(e.MessageType, ShouldEqual, message.MessageBinary)
+			So(e.Payload, ShouldResemble, []byte{byte(i)})
+		}
+	}
+
+	cancel1()
+	So(b2.Publish(&Envelope{Target: ToAll}), ShouldBeNil)
+	So(receive(c2), ShouldNotBeNil)
+	So(receive(c1), ShouldBeNil)
+}
+
+func TestMemoryBroker(t *testing.T) {
+	Convey("Memory broker", t, func() {
+		b := NewMemoryBroker()
+		testBroker(b, b)
+	})
+}
+
+func TestTCPBroker(t *testing.T) {
+	Convey("TCP broker", t, func() {
+		hub, err := ListenTCPHub("127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer hub.Close()
+
+		b1, err := DialTCP(hub.Addr())
+		So(err, ShouldBeNil)
+		defer b1.Close()
+		b2, err := DialTCP(hub.Addr())
+		So(err, ShouldBeNil)
+		defer b2.Close()
+
+		testBroker(b1, b2)
+
+		Convey("hub closed", func() {
+			c := make(chan *Envelope, 1)
+			b1.Subscribe(func(e *Envelope) { c <- e })
+			hub.Close()
+			time.Sleep(50 * time.Millisecond)
+			b2.Publish(&Envelope{Target: ToAll})
+			So(receive(c), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package cluster
+
+import (
+	"sync"
+)
+
+// subscriber queues envelopes for handler, so Publish never waits for handlers.
+type subscriber struct {
+	handler func(e *Envelope)
+	locker  sync.Mutex
+	queue   []*Envelope
+	notify  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newSubscriber(handler func(e *Envelope)) *subscriber {
+	ret := &subscriber{
+		handler: handler,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go ret.loop()
+	return ret
+}
+
+func (s *subscriber) push(e *Envelope) {
+	s.locker.Lock()
+	s.queue = append(s.queue, e)
+	s.locker.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) loop() {
+	for {
+		select {
+		case <-s.notify:
+		case <-s.done:
+			return
+		}
+		s.locker.Lock()
+		queue := s.queue
+		s.queue = nil
+		s.locker.Unlock()
+		for _, e := range queue {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.handler(e)
+		}
+	}
+}
+
+func (s *subscriber) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+}
+
+// subscribers is the set of subscribers of a broker.
+type subscribers struct {
+	locker sync.RWMutex
+	subs   map[*subscriber]struct{}
+}
+
+func (s *subscribers) add(handler func(e *Envelope)) func() {
+	sub := newSubscriber(handler)
+	s.locker.Lock()
+	if s.subs == nil {
+		s.subs = make(map[*subscriber]struct{})
+	}
+	s.subs[sub] = struct{}{}
+	s.locker.Unlock()
+	return func() {
+		s.locker.Lock()
+		delete(s.subs, sub)
+		s.locker.Unlock()
+		sub.close()
+	}
+}
+
+func (s *subscribers) publish(e *Envelope) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+	for sub := range s.subs {
+		sub.push(e)
+	}
+}
+
+func (s *subscribers) closeAll() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	for sub := range s.subs {
+		sub.close()
+	}
+	s.subs = nil
+}
+
+// MemoryBroker is the Broker which connects nodes in the same process, like servers in tests.
+type MemoryBroker struct {
+	subscribers subscribers
+}
+
+// NewMemoryBroker returns a MemoryBroker. Servers sharing it are nodes of the same cluster.
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{}
+}
+
+func (b *MemoryBroker) Publish(e *Envelope) error {
+	b.subscribers.publish(e)
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(handler func(e *Envelope)) (func(), error) {
+	return b.subscribers.add(handler), nil
+}
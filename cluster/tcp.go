@@ -0,0 +1,152 @@
+package cluster
+
+import (
+	"encoding/json"
+	"net"
+	"sync"
+)
+
+// TCPHub relays envelopes between TCPBrokers connected to it, as newline-delimited JSON. It's a broker without external services, like for tests on loopback.
+type TCPHub struct {
+	listener net.Listener
+	locker   sync.Mutex
+	peers    map[*hubPeer]struct{}
+	closed   bool
+}
+
+type hubPeer struct {
+	conn    net.Conn
+	locker  sync.Mutex
+	encoder *json.Encoder
+}
+
+// ListenTCPHub listens on addr, like "127.0.0.1:0", and relays envelopes until it's closed.
+func ListenTCPHub(addr string) (*TCPHub, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	ret := &TCPHub{
+		listener: l,
+		peers:    make(map[*hubPeer]struct{}),
+	}
+	go ret.serve()
+	return ret, nil
+}
+
+// Addr returns the address which hub listens on.
+func (h *TCPHub) Addr() string {
+	return h.listener.Addr().String()
+}
+
+// Close stops listening and disconnects all brokers.
+func (h *TCPHub) Close() error {
+	h.locker.Lock()
+	h.closed = true
+	for p := range h.peers {
+		p.conn.Close()
+	}
+	h.peers = nil
+	h.locker.Unlock()
+	return h.listener.Close()
+}
+
+func (h *TCPHub) serve() {
+	for {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			return
+		}
+		p := &hubPeer{
+			conn:    conn,
+			encoder: json.NewEncoder(conn),
+		}
+		h.locker.Lock()
+		if h.closed {
+			h.locker.Unlock()
+			conn.Close()
+			return
+		}
+		h.peers[p] = struct{}{}
+		h.locker.Unlock()
+		go h.relay(p)
+	}
+}
+
+func (h *TCPHub) relay(from *hubPeer) {
+	defer func() {
+		h.locker.Lock()
+		delete(h.peers, from)
+		h.locker.Unlock()
+		from.conn.Close()
+	}()
+	decoder := json.NewDecoder(from.conn)
+	for {
+		var e Envelope
+		if err := decoder.Decode(&e); err != nil {
+			return
+		}
+		h.locker.Lock()
+		peers := make([]*hubPeer, 0, len(h.peers))
+		for p := range h.peers {
+			peers = append(peers, p)
+		}
+		h.locker.Unlock()
+		for _, p := range peers {
+			p.locker.Lock()
+			if err := p.encoder.Encode(&e); err != nil {
+				p.conn.Close()
+			}
+			p.locker.Unlock()
+		}
+	}
+}
+
+// TCPBroker is the Broker connected to a TCPHub.
+type TCPBroker struct {
+	conn        net.Conn
+	locker      sync.Mutex
+	encoder     *json.Encoder
+	subscribers subscribers
+}
+
+// DialTCP connects to the TCPHub at addr.
+func DialTCP(addr string) (*TCPBroker, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	ret := &TCPBroker{
+		conn:    conn,
+		encoder: json.NewEncoder(conn),
+	}
+	go ret.readLoop()
+	return ret, nil
+}
+
+func (b *TCPBroker) Publish(e *Envelope) error {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	return b.encoder.Encode(e)
+}
+
+func (b *TCPBroker) Subscribe(handler func(e *Envelope)) (func(), error) {
+	return b.subscribers.add(handler), nil
+}
+
+// Close disconnects from hub, and stops all subscriptions.
+func (b *TCPBroker) Close() error {
+	return b.conn.Close()
+}
+
+func (b *TCPBroker) readLoop() {
+	defer b.subscribers.closeAll()
+	decoder := json.NewDecoder(b.conn)
+	for {
+		e := &Envelope{}
+		if err := decoder.Decode(e); err != nil {
+			return
+		}
+		b.subscribers.publish(e)
+	}
+}
@@ -0,0 +1,38 @@
+// Command eio-proxy is a sticky-session reverse proxy for engine.io servers. It sends requests of each session to the backend which owns it, so polling works behind it without ip_hash of load balancers.
+//
+//	eio-proxy -listen :8080 -backends http://10.0.0.1:5000,http://10.0.0.2:5000
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teltechsystems/go-engine.io/proxy"
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	backends := flag.String("backends", "", "comma-separated urls of engine.io servers")
+	cookie := flag.String("cookie", "io", "name of the sid cookie set by backends")
+	timeout := flag.Duration("session-timeout", 2*time.Minute, "how long the owner of an idle session is kept")
+	flag.Parse()
+
+	var urls []string
+	for _, u := range strings.Split(*backends, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	p, err := proxy.New(urls...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p.SetCookie(*cookie)
+	p.SetSessionTimeout(*timeout)
+
+	log.Printf("proxying %s to %s", *listen, strings.Join(urls, ", "))
+	log.Fatal(http.ListenAndServe(*listen, p))
+}
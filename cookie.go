@@ -0,0 +1,81 @@
+package engineio
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// CookieOptions configures the cookie which server sets with sid in handshake response, like the cookie option of node engine.io. Load balancers and proxies can route requests of a session by it.
+type CookieOptions struct {
+	// Disabled disables the cookie.
+	Disabled bool
+
+	// Name is the name of cookie. Default is "io".
+	Name string
+
+	// Path is the path of cookie. Default is "/".
+	Path string
+
+	// Domain is the domain of cookie. Default is empty, which means the host of the handshake request.
+	Domain string
+
+	// MaxAge is the max age of cookie in seconds, 0 means a session cookie and negative means deleting it, like http.Cookie.
+	MaxAge int
+
+	// HttpOnly hides the cookie from scripts. Default is true.
+	HttpOnly bool
+
+	// Secure sends the cookie over https only.
+	Secure bool
+
+	// SameSite is the SameSite attribute of cookie. Default is http.SameSiteLaxMode.
+	SameSite http.SameSite
+}
+
+// DefaultCookieOptions returns the default cookie options of server.
+func DefaultCookieOptions() CookieOptions {
+	return CookieOptions{
+		Name:     "io",
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// cookie returns the cookie of sid, or nil if the cookie is disabled.
+func (o CookieOptions) cookie(sid string) *http.Cookie {
+	if o.Disabled {
+		return nil
+	}
+	return &http.Cookie{
+		Name:     o.Name,
+		Value:    sid,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		HttpOnly: o.HttpOnly,
+		Secure:   o.Secure,
+		SameSite: o.SameSite,
+	}
+}
+
+// validate returns the problems of o.
+func (o CookieOptions) validate() []string {
+	if o.Disabled {
+		return nil
+	}
+	var ret []string
+	if (&http.Cookie{Name: o.Name, Value: "sid"}).String() == "" {
+		ret = append(ret, fmt.Sprintf("invalid cookie name %q", o.Name))
+	}
+	switch o.SameSite {
+	case 0, http.SameSiteDefaultMode, http.SameSiteLaxMode, http.SameSiteStrictMode:
+	case http.SameSiteNoneMode:
+		if !o.Secure {
+			ret = append(ret, "cookie with SameSite=None must be secure")
+		}
+	default:
+		ret = append(ret, fmt.Sprintf("invalid cookie SameSite %d", o.SameSite))
+	}
+	return ret
+}
@@ -0,0 +1,82 @@
+package engineio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCookie(t *testing.T) {
+	handshake := func(server *Server) (*httptest.ResponseRecorder, string) {
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, newOpenReq())
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		return resp, extractSid(resp.Body)
+	}
+	accept := func(server *Server) {
+		go func() {
+			for {
+				if _, err := server.Accept(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+
+	Convey("Default cookie is set only on handshake", t, func() {
+		server, err := NewServer(nil)
+		So(err, ShouldBeNil)
+		accept(server)
+		defer server.Shutdown(context.Background())
+
+		resp, sid := handshake(server)
+		So(resp.Header().Get("Set-Cookie"), ShouldEqual, "io="+sid+"; Path=/; HttpOnly; SameSite=Lax")
+
+		req := newOpenReq()
+		q := req.URL.Query()
+		q.Set("sid", sid)
+		req.URL.RawQuery = q.Encode()
+		req.Method = "POST"
+		resp = httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		So(resp.Header().Get("Set-Cookie"), ShouldEqual, "")
+	})
+
+	Convey("Custom cookie", t, func() {
+		server, err := NewServerWithOptions(WithCookieOptions(CookieOptions{
+			Name:     "eio",
+			Path:     "/engine.io",
+			Domain:   "example.com",
+			MaxAge:   60,
+			Secure:   true,
+			SameSite: http.SameSiteNoneMode,
+		}))
+		So(err, ShouldBeNil)
+		accept(server)
+		defer server.Shutdown(context.Background())
+
+		resp, sid := handshake(server)
+		So(resp.Header().Get("Set-Cookie"), ShouldEqual, "eio="+sid+"; Path=/engine.io; Domain=example.com; Max-Age=60; Secure; SameSite=None")
+	})
+
+	Convey("Disabled cookie", t, func() {
+		server, err := NewServerWithOptions(WithCookieOptions(CookieOptions{Disabled: true}))
+		So(err, ShouldBeNil)
+		accept(server)
+		defer server.Shutdown(context.Background())
+
+		resp, _ := handshake(server)
+		So(resp.Header().Get("Set-Cookie"), ShouldEqual, "")
+	})
+
+	Convey("Invalid cookie", t, func() {
+		_, err := NewServerWithOptions(WithCookieOptions(CookieOptions{Name: "io", SameSite: http.SameSiteNoneMode}))
+		So(err, ShouldResemble, &ConfigError{Problems: []string{"cookie with SameSite=None must be secure"}})
+
+		_, err = NewServerWithOptions(WithCookieOptions(CookieOptions{Path: "/"}))
+		So(err, ShouldResemble, &ConfigError{Problems: []string{`invalid cookie name ""`}})
+	})
+}
@@ -0,0 +1,96 @@
+package engineio
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures cross-origin requests, like XHR polling of a web app on another domain. CORS is disabled if both AllowedOrigins and AllowOriginFunc are empty.
+type CORSOptions struct {
+	// AllowedOrigins are the origins which are allowed, like "https://app.example.com". "*" allows all origins.
+	AllowedOrigins []string
+
+	// AllowOriginFunc checks the origin of requests. If it's not nil, AllowedOrigins is ignored.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowCredentials allows requests with cookies and http authentication. The allowed origin is sent instead of "*" then, as browsers require.
+	AllowCredentials bool
+
+	// AllowedHeaders are the headers which clients can send. If it's empty, the headers requested by preflight requests are allowed.
+	AllowedHeaders []string
+
+	// MaxAge is how long browsers cache the result of preflight requests. 0 means browsers' default.
+	MaxAge time.Duration
+}
+
+func (o CORSOptions) enabled() bool {
+	return len(o.AllowedOrigins) > 0 || o.AllowOriginFunc != nil
+}
+
+// allowOrigin returns the value of Access-Control-Allow-Origin for origin, or "" if origin isn't allowed.
+func (o CORSOptions) allowOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	if o.AllowOriginFunc != nil {
+		if o.AllowOriginFunc(origin) {
+			return origin
+		}
+		return ""
+	}
+	for _, allowed := range o.AllowedOrigins {
+		if allowed == "*" {
+			if o.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// setHeaders sets the CORS headers of r to w. For preflight requests, it also sets the allowed methods, headers and max age.
+func (o CORSOptions) setHeaders(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	origin := o.allowOrigin(r.Header.Get("Origin"))
+	if origin == "" {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if o.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if r.Method != "OPTIONS" || r.Header.Get("Access-Control-Request-Method") == "" {
+		return
+	}
+	header.Set("Access-Control-Allow-Methods", "GET, POST")
+	if len(o.AllowedHeaders) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(o.AllowedHeaders, ", "))
+	} else if h := r.Header.Get("Access-Control-Request-Headers"); h != "" {
+		header.Set("Access-Control-Allow-Headers", h)
+	}
+	if o.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(o.MaxAge/time.Second)))
+	}
+}
+
+// validate returns the problems of o.
+func (o CORSOptions) validate() []string {
+	var ret []string
+	if o.MaxAge < 0 {
+		ret = append(ret, fmt.Sprintf("cors max age %s must not be negative", o.MaxAge))
+	}
+	for _, origin := range o.AllowedOrigins {
+		if origin == "" {
+			ret = append(ret, "empty cors origin")
+		}
+	}
+	return ret
+}
@@ -0,0 +1,118 @@
+package engineio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCORS(t *testing.T) {
+	newServer := func(cors CORSOptions) *Server {
+		server, err := NewServerWithOptions(WithCORS(cors))
+		So(err, ShouldBeNil)
+		go func() {
+			for {
+				if _, err := server.Accept(); err != nil {
+					return
+				}
+			}
+		}()
+		return server
+	}
+	preflight := func(server *Server, origin string) *httptest.ResponseRecorder {
+		req := newOpenReq()
+		req.Method = "OPTIONS"
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type, X-Token")
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		return resp
+	}
+
+	Convey("Allowed origins", t, func() {
+		server := newServer(CORSOptions{
+			AllowedOrigins:   []string{"https://app.example.com"},
+			AllowCredentials: true,
+			AllowedHeaders:   []string{"Content-Type"},
+			MaxAge:           10 * time.Minute,
+		})
+		defer server.Shutdown(context.Background())
+
+		Convey("Preflight", func() {
+			resp := preflight(server, "https://app.example.com")
+			So(resp.Code, ShouldEqual, http.StatusNoContent)
+			h := resp.Header()
+			So(h.Get("Access-Control-Allow-Origin"), ShouldEqual, "https://app.example.com")
+			So(h.Get("Access-Control-Allow-Credentials"), ShouldEqual, "true")
+			So(h.Get("Access-Control-Allow-Methods"), ShouldEqual, "GET, POST")
+			So(h.Get("Access-Control-Allow-Headers"), ShouldEqual, "Content-Type")
+			So(h.Get("Access-Control-Max-Age"), ShouldEqual, "600")
+			So(h.Get("Vary"), ShouldEqual, "Origin")
+			So(server.Count(), ShouldEqual, 0)
+		})
+
+		Convey("Handshake and polling", func() {
+			req := newOpenReq()
+			req.Header.Set("Origin", "https://app.example.com")
+			resp := httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://app.example.com")
+			So(resp.Header().Get("Access-Control-Allow-Credentials"), ShouldEqual, "true")
+			So(resp.Header().Get("Access-Control-Allow-Methods"), ShouldEqual, "")
+			sid := extractSid(resp.Body)
+
+			req, _ = http.NewRequest("POST", "/?transport=polling&sid="+sid, strings.NewReader("1:6"))
+			req.Header.Set("Origin", "https://app.example.com")
+			resp = httptest.NewRecorder()
+			server.ServeHTTP(resp, req)
+			So(resp.Code, ShouldEqual, http.StatusOK)
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://app.example.com")
+		})
+
+		Convey("Other origins", func() {
+			resp := preflight(server, "https://evil.example.com")
+			So(resp.Code, ShouldEqual, http.StatusNoContent)
+			So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "")
+			So(resp.Header().Get("Access-Control-Allow-Methods"), ShouldEqual, "")
+		})
+	})
+
+	Convey("Wildcard and func", t, func() {
+		server := newServer(CORSOptions{AllowedOrigins: []string{"*"}})
+		defer server.Shutdown(context.Background())
+		resp := preflight(server, "https://any.example.com")
+		So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "*")
+		So(resp.Header().Get("Access-Control-Allow-Credentials"), ShouldEqual, "")
+		So(resp.Header().Get("Access-Control-Allow-Headers"), ShouldEqual, "Content-Type, X-Token")
+
+		server.Reconfigure(false, WithCORS(CORSOptions{
+			AllowOriginFunc: func(origin string) bool {
+				return strings.HasSuffix(origin, ".example.com")
+			},
+		}))
+		So(preflight(server, "https://a.example.com").Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://a.example.com")
+		So(preflight(server, "https://example.org").Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "")
+	})
+
+	Convey("Disabled", t, func() {
+		server := newServer(CORSOptions{})
+		defer server.Shutdown(context.Background())
+		resp := preflight(server, "https://app.example.com")
+		So(resp.Code, ShouldEqual, http.StatusNoContent)
+		So(resp.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "")
+		So(resp.Header().Get("Vary"), ShouldEqual, "")
+		So(server.Count(), ShouldEqual, 0)
+	})
+
+	Convey("Invalid", t, func() {
+		_, err := NewServerWithOptions(WithCORS(CORSOptions{AllowedOrigins: []string{""}, MaxAge: -time.Second}))
+		So(err, ShouldResemble, &ConfigError{Problems: []string{"cors max age -1s must not be negative", "empty cors origin"}})
+	})
+}
@@ -0,0 +1,53 @@
+// Package engineiotest provides an in-memory transport and helpers to test applications of engine.io without sockets.
+package engineiotest
+
+import (
+	"context"
+	"net/http"
+
+	engineio "github.com/teltechsystems/go-engine.io"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+// Register registers the server side of in-memory transport, so servers created after it by engineio.NewServer accept in-memory clients, if Name is in their transports. Servers created by engineio.NewServer(nil) then support in-memory transport too, so only tests should call it. Option enables it for one server only.
+func Register() {
+	engineio.RegisterTransport(Creater(http.NotFoundHandler()))
+}
+
+// Option enables the server side of in-memory transport on the server created by engineio.NewServerWithOptions, without registering it.
+func Option() engineio.Option {
+	return engineio.WithTransportCreaters(Creater(http.NotFoundHandler()))
+}
+
+// Dial connects to server in memory. Server must support in-memory transport, like engineio.NewServerWithOptions(engineiotest.Option()), or engineio.NewServer([]string{engineiotest.Name}) after Register.
+func Dial(server *engineio.Server) (engineio.Conn, error) {
+	return engineio.Dial("http://engineiotest/engine.io/", &engineio.DialOptions{
+		Transports:      []transport.Creater{Creater(server)},
+		DisableUpgrades: true,
+	})
+}
+
+// NewPair returns a connected pair of connections, the first one is accepted by a new server, the second one is the client. The server only supports in-memory transport, and registers nothing. shutdown shuts down the server, and closes both connections.
+func NewPair() (server, client engineio.Conn, shutdown func(), err error) {
+	s, err := engineio.NewServerWithOptions(Option(), engineio.WithTransports(Name))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	connChan := make(chan engineio.Conn, 1)
+	go func() {
+		conn, err := s.Accept()
+		if err == nil {
+			connChan <- conn
+		}
+	}()
+	client, err = Dial(s)
+	if err != nil {
+		// Accept returns after shutdown.
+		s.Shutdown(context.Background())
+		return nil, nil, nil, err
+	}
+	shutdown = func() {
+		s.Shutdown(context.Background())
+	}
+	return <-connChan, client, shutdown, nil
+}
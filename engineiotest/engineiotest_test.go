@@ -0,0 +1,127 @@
+package engineiotest
+
+import (
+	"io/ioutil"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	engineio "github.com/teltechsystems/go-engine.io"
+)
+
+func send(conn engineio.Conn, t engineio.MessageType, data string) {
+	w, err := conn.NextWriter(t)
+	So(err, ShouldBeNil)
+	_, err = w.Write([]byte(data))
+	So(err, ShouldBeNil)
+	So(w.Close(), ShouldBeNil)
+}
+
+func receive(conn engineio.Conn) (engineio.MessageType, string) {
+	t, r, err := conn.NextReader()
+	So(err, ShouldBeNil)
+	b, err := ioutil.ReadAll(r)
+	So(err, ShouldBeNil)
+	So(r.Close(), ShouldBeNil)
+	return t, string(b)
+}
+
+func TestNewPair(t *testing.T) {
+	Convey("New pair", t, func() {
+		server, client, shutdown, err := NewPair()
+		So(err, ShouldBeNil)
+		defer shutdown()
+		So(server.Id(), ShouldEqual, client.Id())
+
+		// in-memory transport isn't registered.
+		_, err = engineio.NewServer([]string{Name})
+		So(err, ShouldEqual, engineio.InvalidError)
+
+		for _, typ := range []engineio.MessageType{engineio.MessageText, engineio.MessageBinary} {
+			send(client, typ, "hello")
+			send(client, typ, "world")
+			rt, data := receive(server)
+			So(rt, ShouldEqual, typ)
+			So(data, ShouldEqual, "hello")
+			_, data = receive(server)
+			So(data, ShouldEqual, "world")
+
+			send(server, typ, "\x00\x01")
+			rt, data = receive(client)
+			So(rt, ShouldEqual, typ)
+			So(data, ShouldEqual, "\x00\x01")
+		}
+
+		Convey("Closed by server", func() {
+			So(server.Close(), ShouldBeNil)
+			_, _, err := client.NextReader()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Closed by client", func() {
+			So(client.Close(), ShouldBeNil)
+			_, _, err := server.NextReader()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDial(t *testing.T) {
+	Convey("Dial server", t, func() {
+		Register()
+		server, err := engineio.NewServer([]string{Name})
+		So(err, ShouldBeNil)
+		go func() {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			t, r, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+			b, _ := ioutil.ReadAll(r)
+			r.Close()
+			w, _ := conn.NextWriter(t)
+			w.Write(b)
+			w.Close()
+		}()
+
+		conn, err := Dial(server)
+		So(err, ShouldBeNil)
+		So(server.Count(), ShouldEqual, 1)
+
+		send(conn, engineio.MessageText, "echo")
+		_, data := receive(conn)
+		So(data, ShouldEqual, "echo")
+
+		_, _, err = conn.NextReader()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Shutdown closes the pair", t, func() {
+		server, client, shutdown, err := NewPair()
+		So(err, ShouldBeNil)
+		shutdown()
+		_, _, err = server.NextReader()
+		So(err, ShouldNotBeNil)
+		_, _, err = client.NextReader()
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Dial server with option", t, func() {
+		server, err := engineio.NewServerWithOptions(Option())
+		So(err, ShouldBeNil)
+		go server.Accept()
+		conn, err := Dial(server)
+		So(err, ShouldBeNil)
+		So(conn.Close(), ShouldBeNil)
+	})
+
+	Convey("Dial server without in-memory transport", t, func() {
+		server, err := engineio.NewServer([]string{"polling"})
+		So(err, ShouldBeNil)
+		_, err = Dial(server)
+		So(err, ShouldNotBeNil)
+	})
+}
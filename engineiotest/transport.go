@@ -0,0 +1,265 @@
+package engineiotest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+// Name is the name of in-memory transport.
+const Name = "memory"
+
+var InvalidError = errors.New("not an in-memory request")
+
+// Creater returns the creater of in-memory transport. Its client sends requests to handler directly instead of network, and the server side exchanges packets with the client through memory.
+func Creater(handler http.Handler) transport.Creater {
+	return transport.Creater{
+		Name:      Name,
+		Upgrading: false,
+		Server:    NewServer,
+		Client: func(r *http.Request) (transport.Client, error) {
+			return NewClient(handler, r)
+		},
+	}
+}
+
+type pipeKey struct{}
+
+// pipe connects a client and a server. Packets are queued without limit, so writing never blocks.
+type pipe struct {
+	toServer   *queue
+	toClient   *queue
+	attached   chan struct{}
+	attachOnce sync.Once
+}
+
+func newPipe() *pipe {
+	return &pipe{
+		toServer: newQueue(),
+		toClient: newQueue(),
+		attached: make(chan struct{}),
+	}
+}
+
+func (p *pipe) close() {
+	p.toServer.close()
+	p.toClient.close()
+}
+
+type queue struct {
+	locker  sync.Mutex
+	packets [][]byte
+	signal  chan struct{}
+	closed  bool
+}
+
+func newQueue() *queue {
+	return &queue{
+		signal: make(chan struct{}, 1),
+	}
+}
+
+func (q *queue) push(b []byte) error {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+	if q.closed {
+		return io.EOF
+	}
+	q.packets = append(q.packets, b)
+	q.notify()
+	return nil
+}
+
+// pop returns the next packet. It blocks until a packet is pushed, and returns io.EOF if queue is closed and empty.
+func (q *queue) pop() ([]byte, error) {
+	for {
+		q.locker.Lock()
+		if len(q.packets) > 0 {
+			b := q.packets[0]
+			q.packets = q.packets[1:]
+			q.locker.Unlock()
+			return b, nil
+		}
+		if q.closed {
+			q.locker.Unlock()
+			return nil, io.EOF
+		}
+		q.locker.Unlock()
+		<-q.signal
+	}
+}
+
+func (q *queue) close() {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+	q.closed = true
+	q.notify()
+}
+
+func (q *queue) notify() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+type Server struct {
+	callback transport.Callback
+	pipe     *pipe
+}
+
+// NewServer attaches to the pipe of in-memory request r. It returns InvalidError if r doesn't come from the in-memory client.
+func NewServer(w http.ResponseWriter, r *http.Request, callback transport.Callback) (transport.Server, error) {
+	p, ok := r.Context().Value(pipeKey{}).(*pipe)
+	if !ok {
+		return nil, InvalidError
+	}
+	ret := &Server{
+		callback: callback,
+		pipe:     p,
+	}
+	p.attachOnce.Do(func() {
+		close(p.attached)
+	})
+
+	go ret.serve()
+
+	return ret, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Value(pipeKey{}) == s.pipe {
+		// the request is served by NewServer.
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+func (s *Server) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	return newWriter(s.pipe.toClient, msgType, packetType)
+}
+
+func (s *Server) Close() error {
+	s.pipe.close()
+	return nil
+}
+
+func (s *Server) serve() {
+	defer s.callback.OnClose(s)
+
+	for {
+		b, err := s.pipe.toServer.pop()
+		if err != nil {
+			return
+		}
+		decoder, err := parser.NewDecoder(bytes.NewReader(b))
+		if err != nil {
+			s.pipe.close()
+			return
+		}
+		s.callback.OnPacket(decoder)
+		decoder.Close()
+	}
+}
+
+type client struct {
+	pipe *pipe
+	resp *http.Response
+}
+
+// NewClient sends request r to handler in a new goroutine, and returns the client once the server side attaches to it.
+func NewClient(handler http.Handler, r *http.Request) (transport.Client, error) {
+	p := newPipe()
+	req := r.WithContext(context.WithValue(r.Context(), pipeKey{}, p))
+	req.Body = http.NoBody
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(w, req)
+	}()
+
+	select {
+	case <-p.attached:
+	case <-done:
+		select {
+		case <-p.attached:
+		default:
+			p.close()
+			return nil, fmt.Errorf("handshake failed: %s", bytes.TrimSpace(w.Body.Bytes()))
+		}
+	}
+	return &client{
+		pipe: p,
+		resp: &http.Response{
+			Status:     "200 OK",
+			StatusCode: http.StatusOK,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       http.NoBody,
+			Request:    req,
+		},
+	}, nil
+}
+
+func (c *client) Response() *http.Response {
+	return c.resp
+}
+
+func (c *client) NextReader() (*parser.PacketDecoder, error) {
+	b, err := c.pipe.toClient.pop()
+	if err != nil {
+		return nil, err
+	}
+	return parser.NewDecoder(bytes.NewReader(b))
+}
+
+func (c *client) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	return newWriter(c.pipe.toServer, msgType, packetType)
+}
+
+func (c *client) Close() error {
+	c.pipe.close()
+	return nil
+}
+
+type writer struct {
+	*parser.PacketEncoder
+	buf   *bytes.Buffer
+	queue *queue
+}
+
+func newWriter(q *queue, msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	newEncoder := parser.NewStringEncoder
+	if msgType == message.MessageBinary {
+		newEncoder = parser.NewBinaryEncoder
+	}
+	buf := bytes.NewBuffer(nil)
+	encoder, err := newEncoder(buf, packetType)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{
+		PacketEncoder: encoder,
+		buf:           buf,
+		queue:         q,
+	}, nil
+}
+
+func (w *writer) Close() error {
+	if err := w.PacketEncoder.Close(); err != nil {
+		return err
+	}
+	return w.queue.push(w.buf.Bytes())
+}
@@ -0,0 +1,80 @@
+package engineio
+
+import (
+	"fmt"
+)
+
+// DisconnectReason is the reason why a connection is closed.
+type DisconnectReason int
+
+const (
+	// ReasonTransportClose means the transport is closed, like the client goes away without CLOSE packet.
+	ReasonTransportClose DisconnectReason = iota
+	// ReasonTransportError means the transport is broken by an error.
+	ReasonTransportError
+	// ReasonPingTimeout means the client doesn't ping or pong in time.
+	ReasonPingTimeout
+	// ReasonClientClose means the client closes the connection: it sends CLOSE packet, or Close is called on client side.
+	ReasonClientClose
+	// ReasonServerClose means the server closes the connection: Close is called on server side, or client receives CLOSE packet.
+	ReasonServerClose
+	// ReasonServerShutdown means the server is shut down.
+	ReasonServerShutdown
+	// ReasonUpgradeError means the connection is lost while upgrading transport.
+	ReasonUpgradeError
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case ReasonTransportClose:
+		return "transport close"
+	case ReasonTransportError:
+		return "transport error"
+	case ReasonPingTimeout:
+		return "ping timeout"
+	case ReasonClientClose:
+		return "client close"
+	case ReasonServerClose:
+		return "forced close"
+	case ReasonServerShutdown:
+		return "server shutdown"
+	case ReasonUpgradeError:
+		return "upgrade error"
+	}
+	return "unknown"
+}
+
+// CloseError is the error of closed connection, returned by Conn.Err.
+type CloseError struct {
+	Reason DisconnectReason
+
+	// Err is the transport error which breaks the connection, if any.
+	Err error
+}
+
+func (e *CloseError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Reason, e.Err)
+	}
+	return e.Reason.String()
+}
+
+func (e *CloseError) Unwrap() error {
+	return e.Err
+}
+
+// Hooks are the callbacks of connection lifecycle. They're called synchronously, so they shouldn't block. Nil ones are skipped.
+type Hooks struct {
+
+	// OnConnection is called when a connection is established, before it's returned by Accept.
+	OnConnection func(conn Conn)
+
+	// OnUpgrade is called when the connection upgrades from transport from to transport to.
+	OnUpgrade func(conn Conn, from, to string)
+
+	// OnDisconnect is called when the connection is closed.
+	OnDisconnect func(conn Conn, reason DisconnectReason)
+
+	// OnTransportError is called when transport of the connection reports an error. It may be the transport which is being upgraded to.
+	OnTransportError func(conn Conn, transport string, err error)
+}
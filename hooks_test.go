@@ -0,0 +1,132 @@
+package engineio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type hookEvents struct {
+	connections chan Conn
+	upgrades    chan string
+	disconnects chan DisconnectReason
+	errors      chan string
+}
+
+func newHookEvents(server *Server) *hookEvents {
+	ret := &hookEvents{
+		connections: make(chan Conn, 10),
+		upgrades:    make(chan string, 10),
+		disconnects: make(chan DisconnectReason, 10),
+		errors:      make(chan string, 10),
+	}
+	server.SetHooks(Hooks{
+		OnConnection: func(conn Conn) {
+			ret.connections <- conn
+		},
+		OnUpgrade: func(conn Conn, from, to string) {
+			ret.upgrades <- from + "->" + to
+		},
+		OnDisconnect: func(conn Conn, reason DisconnectReason) {
+			ret.disconnects <- reason
+		},
+		OnTransportError: func(conn Conn, transport string, err error) {
+			ret.errors <- transport
+		},
+	})
+	return ret
+}
+
+func (e *hookEvents) disconnect() DisconnectReason {
+	select {
+	case r := <-e.disconnects:
+		return r
+	case <-time.After(5 * time.Second):
+		return -1
+	}
+}
+
+func TestHooks(t *testing.T) {
+	Convey("Hooks", t, func() {
+		server, h := newEchoServer()
+		defer h.Close()
+		events := newHookEvents(server)
+
+		Convey("connect, upgrade and close by client", func() {
+			conn, err := Dial(h.URL, nil)
+			So(err, ShouldBeNil)
+			So((<-events.connections).Id(), ShouldEqual, conn.Id())
+
+			select {
+			case upgrade := <-events.upgrades:
+				So(upgrade, ShouldEqual, "polling->websocket")
+			case <-time.After(5 * time.Second):
+				So("upgraded", ShouldBeEmpty)
+			}
+
+			So(conn.(CloseReasonConn).Err(), ShouldBeNil)
+			So(conn.Close(), ShouldBeNil)
+			So(events.disconnect(), ShouldEqual, ReasonClientClose)
+			So(conn.(CloseReasonConn).Err(), ShouldResemble, &CloseError{Reason: ReasonClientClose})
+		})
+
+		Convey("close by server", func() {
+			conn, err := Dial(h.URL, nil)
+			So(err, ShouldBeNil)
+			serverConn := <-events.connections
+			// CLOSE packet may be dropped by polling if client isn't polling at the moment.
+			<-events.upgrades
+			So(serverConn.(CloseReasonConn).Err(), ShouldBeNil)
+			serverConn.Close()
+			So(events.disconnect(), ShouldEqual, ReasonServerClose)
+			So(serverConn.(CloseReasonConn).Err(), ShouldResemble, &CloseError{Reason: ReasonServerClose})
+
+			_, _, err = conn.NextReader()
+			So(err, ShouldEqual, io.EOF)
+			So(conn.(CloseReasonConn).CloseReason(), ShouldEqual, ReasonServerClose)
+			So(conn.(CloseReasonConn).Err().Error(), ShouldEqual, "forced close")
+		})
+
+		Convey("ping timeout", func() {
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, newOpenReq())
+			So(res.Code, ShouldEqual, http.StatusOK)
+			So(events.disconnect(), ShouldEqual, ReasonPingTimeout)
+			conn := <-events.connections
+			_, _, err := conn.NextReader()
+			So(err, ShouldEqual, io.EOF)
+			So(conn.(CloseReasonConn).CloseReason(), ShouldEqual, ReasonPingTimeout)
+		})
+
+		Convey("transport error", func() {
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, newOpenReq())
+			sid := extractSid(res.Body)
+
+			req, _ := http.NewRequest("POST", "/?transport=polling&sid="+sid, bytes.NewBufferString("1:x"))
+			res = httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+			So(res.Code, ShouldEqual, http.StatusBadRequest)
+			So(<-events.errors, ShouldEqual, "polling")
+		})
+
+		Convey("shutdown", func() {
+			_, err := Dial(h.URL, nil)
+			So(err, ShouldBeNil)
+			So(server.Shutdown(context.Background()), ShouldBeNil)
+			So(events.disconnect(), ShouldEqual, ReasonServerShutdown)
+		})
+	})
+
+	Convey("Disconnect reason string", t, func() {
+		So(ReasonPingTimeout.String(), ShouldEqual, "ping timeout")
+		So(ReasonServerShutdown.String(), ShouldEqual, "server shutdown")
+		So(DisconnectReason(100).String(), ShouldEqual, "unknown")
+	})
+}
@@ -10,6 +10,7 @@ import (
 type connReader struct {
 	*parser.PacketDecoder
 	closeChan chan struct{}
+	stats     *connStats
 }
 
 func newConnReader(d *parser.PacketDecoder, closeChan chan struct{}) *connReader {
@@ -19,6 +20,14 @@ func newConnReader(d *parser.PacketDecoder, closeChan chan struct{}) *connReader
 	}
 }
 
+func (r *connReader) Read(p []byte) (int, error) {
+	n, err := r.PacketDecoder.Read(p)
+	if r.stats != nil {
+		r.stats.addBytesIn(int64(n))
+	}
+	return n, err
+}
+
 func (r *connReader) Close() error {
 	if r.closeChan == nil {
 		return nil
@@ -0,0 +1,67 @@
+// Package metrics defines the collector of server-wide engine.io metrics, and an exporter of Prometheus text format.
+package metrics
+
+// HandshakeResult is the result of a handshake request.
+type HandshakeResult string
+
+const (
+	// HandshakeAccepted means the session is established.
+	HandshakeAccepted HandshakeResult = "accepted"
+	// HandshakeRejectedAllowRequest means the request is rejected by AllowRequest.
+	HandshakeRejectedAllowRequest HandshakeResult = "allow_request"
+	// HandshakeRejectedMaxConnection means the request is rejected because of MaxConnection.
+	HandshakeRejectedMaxConnection HandshakeResult = "max_connection"
+	// HandshakeRejectedProtocol means the request asks an unsupported protocol.
+	HandshakeRejectedProtocol HandshakeResult = "protocol"
+	// HandshakeRejectedClosed means the request is rejected because the server is shut down.
+	HandshakeRejectedClosed HandshakeResult = "server_closed"
+	// HandshakeFailed means the transport fails to open the session.
+	HandshakeFailed HandshakeResult = "failed"
+)
+
+// Direction is the direction of data, relative to the server.
+type Direction string
+
+const (
+	In  Direction = "in"
+	Out Direction = "out"
+)
+
+// Metrics collects metrics of engine.io server. Methods are called concurrently, and should return quickly.
+type Metrics interface {
+	// SessionOpened is called when a session is established with transport.
+	SessionOpened(transport string)
+
+	// SessionClosed is called when a session is closed, with its current transport.
+	SessionClosed(transport string)
+
+	// Handshake is called with the result of every handshake request.
+	Handshake(result HandshakeResult)
+
+	// Upgrade is called when a session finishes upgrading from one transport to another. If ok, the session moves to transport to.
+	Upgrade(from, to string, ok bool)
+
+	// PingTimeout is called when a session is closed because of ping timeout.
+	PingTimeout()
+
+	// PollingRequest is called when a polling request is served, with its method and response status.
+	PollingRequest(method string, status int)
+
+	// WebsocketFrame is called for each websocket frame received or sent.
+	WebsocketFrame(direction Direction)
+
+	// PayloadSize is called with the bytes of each polling payload or websocket frame.
+	PayloadSize(transport string, direction Direction, size int)
+}
+
+// Nop is the Metrics which discards everything. It can be embedded to implement only some methods of Metrics.
+type Nop struct{}
+
+func (Nop) SessionOpened(transport string)                              {}
+func (Nop) SessionClosed(transport string)                              {}
+func (Nop) Handshake(result HandshakeResult)                            {}
+func (Nop) Upgrade(from, to string, ok bool)                            {}
+func (Nop) PingTimeout()                                                {}
+func (Nop) PollingRequest(method string, status int)                    {}
+func (Nop) WebsocketFrame(direction Direction)                          {}
+func (Nop) PayloadSize(transport string, direction Direction, size int) {}
@@ -0,0 +1,204 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of payload size histogram in bytes.
+var DefaultBuckets = []float64{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+// Prometheus is the Metrics which counts in memory, and serves them in Prometheus text exposition format as an http.Handler.
+type Prometheus struct {
+	namespace   string
+	buckets     []float64
+	locker      sync.Mutex
+	sessions    map[string]int64
+	handshakes  map[string]int64
+	upgrades    map[string]int64
+	pingTimeout int64
+	polling     map[string]int64
+	frames      map[string]int64
+	payloads    map[string]*histogram
+}
+
+// NewPrometheus returns a Prometheus with metric names prefixed by namespace, "engineio" if it's empty. If buckets is nil, DefaultBuckets is used.
+func NewPrometheus(namespace string, buckets []float64) *Prometheus {
+	if namespace == "" {
+		namespace = "engineio"
+	}
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Prometheus{
+		namespace:  namespace,
+		buckets:    buckets,
+		sessions:   make(map[string]int64),
+		handshakes: make(map[string]int64),
+		upgrades:   make(map[string]int64),
+		polling:    make(map[string]int64),
+		frames:     make(map[string]int64),
+		payloads:   make(map[string]*histogram),
+	}
+}
+
+func (p *Prometheus) SessionOpened(transport string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.sessions[labels("transport", transport)]++
+}
+
+func (p *Prometheus) SessionClosed(transport string) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.sessions[labels("transport", transport)]--
+}
+
+func (p *Prometheus) Handshake(result HandshakeResult) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.handshakes[labels("result", string(result))]++
+}
+
+func (p *Prometheus) Upgrade(from, to string, ok bool) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	result := "failure"
+	if ok {
+		result = "success"
+		p.sessions[labels("transport", from)]--
+		p.sessions[labels("transport", to)]++
+	}
+	p.upgrades[labels("from", from, "to", to, "result", result)]++
+}
+
+func (p *Prometheus) PingTimeout() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.pingTimeout++
+}
+
+func (p *Prometheus) PollingRequest(method string, status int) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.polling[labels("method", method, "status", strconv.Itoa(status))]++
+}
+
+func (p *Prometheus) WebsocketFrame(direction Direction) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	p.frames[labels("direction", string(direction))]++
+}
+
+func (p *Prometheus) PayloadSize(transport string, direction Direction, size int) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	key := labels("transport", transport, "direction", string(direction))
+	h, ok := p.payloads[key]
+	if !ok {
+		h = &histogram{
+			counts: make([]int64, len(p.buckets)),
+		}
+		p.payloads[key] = h
+	}
+	for i, bound := range p.buckets {
+		if float64(size) <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += float64(size)
+}
+
+// ServeHTTP renders all metrics in Prometheus text exposition format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buf := bytes.NewBuffer(nil)
+	p.render(buf)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func (p *Prometheus) render(buf *bytes.Buffer) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	p.writeSeries(buf, "sessions_active", "gauge", "Number of active sessions by transport.", p.sessions)
+	p.writeSeries(buf, "handshakes_total", "counter", "Number of handshake requests by result.", p.handshakes)
+	p.writeSeries(buf, "upgrades_total", "counter", "Number of transport upgrades by result.", p.upgrades)
+	p.writeSeries(buf, "ping_timeouts_total", "counter", "Number of sessions closed by ping timeout.", map[string]int64{"": p.pingTimeout})
+	p.writeSeries(buf, "polling_requests_total", "counter", "Number of polling requests by method and status.", p.polling)
+	p.writeSeries(buf, "websocket_frames_total", "counter", "Number of websocket frames by direction.", p.frames)
+
+	name := p.namespace + "_payload_size_bytes"
+	fmt.Fprintf(buf, "# HELP %s Size of polling payloads and websocket frames in bytes.\n", name)
+	fmt.Fprintf(buf, "# TYPE %s histogram\n", name)
+	keys := make([]string, 0, len(p.payloads))
+	for key := range p.payloads {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		h := p.payloads[key]
+		for i, bound := range p.buckets {
+			le := labels("le", strconv.FormatFloat(bound, 'g', -1, 64))
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", name, joinLabels(key, le), h.counts[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", name, joinLabels(key, labels("le", "+Inf")), h.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", name, key, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(buf, "%s_count%s %d\n", name, key, h.count)
+	}
+}
+
+func (p *Prometheus) writeSeries(buf *bytes.Buffer, name, typ, help string, series map[string]int64) {
+	name = p.namespace + "_" + name
+	fmt.Fprintf(buf, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(buf, "# TYPE %s %s\n", name, typ)
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(buf, "%s%s %d\n", name, key, series[key])
+	}
+}
+
+// labels returns the label set of name and value pairs, like {name="value"}.
+func labels(pairs ...string) string {
+	buf := bytes.NewBuffer(nil)
+	buf.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(pairs[i])
+		buf.WriteString(`="`)
+		buf.WriteString(labelEscaper.Replace(pairs[i+1]))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('}')
+	return buf.String()
+}
+
+// joinLabels merges label sets a and b.
+func joinLabels(a, b string) string {
+	if a == "" || a == "{}" {
+		return b
+	}
+	return a[:len(a)-1] + "," + b[1:]
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
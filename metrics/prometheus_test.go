@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPrometheus(t *testing.T) {
+	Convey("Render text exposition format", t, func() {
+		p := NewPrometheus("eio", []float64{100, 10})
+		var m Metrics = p
+		m.SessionOpened("polling")
+		m.SessionOpened("polling")
+		m.Upgrade("polling", "websocket", true)
+		m.Upgrade("polling", "websocket", false)
+		m.SessionClosed("polling")
+		m.Handshake(HandshakeAccepted)
+		m.PingTimeout()
+		m.PollingRequest("GET", 200)
+		m.WebsocketFrame(In)
+		m.PayloadSize("polling", In, 5)
+		m.PayloadSize("polling", In, 50)
+		m.PayloadSize("polling", In, 500)
+
+		resp := httptest.NewRecorder()
+		p.ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+		So(resp.Header().Get("Content-Type"), ShouldStartWith, "text/plain; version=0.0.4")
+		lines := strings.Split(resp.Body.String(), "\n")
+		So(lines, ShouldContain, "# TYPE eio_sessions_active gauge")
+		So(lines, ShouldContain, `eio_sessions_active{transport="polling"} 0`)
+		So(lines, ShouldContain, `eio_sessions_active{transport="websocket"} 1`)
+		So(lines, ShouldContain, `eio_upgrades_total{from="polling",to="websocket",result="success"} 1`)
+		So(lines, ShouldContain, `eio_upgrades_total{from="polling",to="websocket",result="failure"} 1`)
+		So(lines, ShouldContain, `eio_handshakes_total{result="accepted"} 1`)
+		So(lines, ShouldContain, `eio_ping_timeouts_total 1`)
+		So(lines, ShouldContain, `eio_polling_requests_total{method="GET",status="200"} 1`)
+		So(lines, ShouldContain, `eio_websocket_frames_total{direction="in"} 1`)
+		So(lines, ShouldContain, "# TYPE eio_payload_size_bytes histogram")
+		So(lines, ShouldContain, `eio_payload_size_bytes_bucket{transport="polling",direction="in",le="10"} 1`)
+		So(lines, ShouldContain, `eio_payload_size_bytes_bucket{transport="polling",direction="in",le="100"} 2`)
+		So(lines, ShouldContain, `eio_payload_size_bytes_bucket{transport="polling",direction="in",le="+Inf"} 3`)
+		So(lines, ShouldContain, `eio_payload_size_bytes_sum{transport="polling",direction="in"} 555`)
+		So(lines, ShouldContain, `eio_payload_size_bytes_count{transport="polling",direction="in"} 3`)
+	})
+
+	Convey("Escape label values", t, func() {
+		So(labels("a", "x\"y\\z\n"), ShouldEqual, `{a="x\"y\\z\n"}`)
+	})
+}
@@ -0,0 +1,314 @@
+package engineio
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/teltechsystems/go-engine.io/cluster"
+	"github.com/teltechsystems/go-engine.io/metrics"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+// Option configures the server of NewServerWithOptions.
+type Option func(o *options)
+
+type options struct {
+	transports []string
+	creaters   transportCreaters
+	config     config
+	sessions   Sessions
+	rooms      RoomsBackend
+	broker     cluster.Broker
+}
+
+// WithTransports sets the transports which server supports, which are registered by RegisterTransport. At least one is required. Default is all registered transports.
+func WithTransports(names ...string) Option {
+	return func(o *options) {
+		o.transports = append([]string{}, names...)
+	}
+}
+
+// WithTransportCreaters adds transport creaters to server only, without registering them by RegisterTransport. They replace registered ones with the same name, and can be enabled by name in WithTransports.
+func WithTransportCreaters(creaters ...transport.Creater) Option {
+	return func(o *options) {
+		o.creaters = append(o.creaters, creaters...)
+	}
+}
+
+// WithPingTimeout sets the timeout of ping, which must be longer than ping interval. Default is 60s.
+func WithPingTimeout(t time.Duration) Option {
+	return func(o *options) {
+		o.config.PingTimeout = t
+	}
+}
+
+// WithPingInterval sets the interval of ping. Default is 25s.
+func WithPingInterval(t time.Duration) Option {
+	return func(o *options) {
+		o.config.PingInterval = t
+	}
+}
+
+// WithMaxConnection sets the max number of connections, which must be positive. Default is 1000.
+func WithMaxConnection(n int) Option {
+	return func(o *options) {
+		o.config.MaxConnection = n
+	}
+}
+
+// WithAllowRequest sets the function which checks handshake requests, like SetAllowRequest. Default allows all requests.
+func WithAllowRequest(f func(*http.Request) error) Option {
+	return func(o *options) {
+		o.config.AllowRequest = f
+	}
+}
+
+// WithAllowUpgrades sets whether server allows transport upgrade. Default is true.
+func WithAllowUpgrades(allow bool) Option {
+	return func(o *options) {
+		o.config.AllowUpgrades = allow
+	}
+}
+
+// WithCookie sets the name of cookie which used by engine.io. Default is "io".
+func WithCookie(name string) Option {
+	return func(o *options) {
+		o.config.Cookie.Name = name
+	}
+}
+
+// WithCookieOptions sets the cookie which server sets with sid in handshake response. Default is DefaultCookieOptions().
+func WithCookieOptions(cookie CookieOptions) Option {
+	return func(o *options) {
+		o.config.Cookie = cookie
+	}
+}
+
+// WithCORS sets the options of cross-origin requests. CORS is disabled by default.
+func WithCORS(cors CORSOptions) Option {
+	return func(o *options) {
+		o.config.CORS = cors
+	}
+}
+
+// WithNewId sets the function to generate new connection id. Default id is generated from remote addr and current time stamp.
+func WithNewId(f func(*http.Request) string) Option {
+	return func(o *options) {
+		o.config.NewId = f
+	}
+}
+
+// WithAllowEIO3 sets whether server accepts clients of engine.io protocol v3. Default is true.
+func WithAllowEIO3(allow bool) Option {
+	return func(o *options) {
+		o.config.AllowEIO3 = allow
+	}
+}
+
+// WithMaxPayload sets the max bytes of payload which client can post in one request, 0 means no limit. Default is 1MB.
+func WithMaxPayload(n int64) Option {
+	return func(o *options) {
+		o.config.MaxPayload = n
+	}
+}
+
+// WithHooks sets the callbacks of connection lifecycle.
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		o.config.Hooks = hooks
+	}
+}
+
+// WithMetrics sets the collector which server and transports report metrics to. Default discards all metrics.
+func WithMetrics(m metrics.Metrics) Option {
+	return func(o *options) {
+		if m == nil {
+			m = metrics.Nop{}
+		}
+		o.config.Metrics = m
+	}
+}
+
+// WithSessionManager sets the session manager of server, like SetSessionManager.
+func WithSessionManager(sessions Sessions) Option {
+	return func(o *options) {
+		o.sessions = sessions
+	}
+}
+
+// WithRoomsBackend sets the backend which stores membership of rooms. Default backend stores it in memory.
+func WithRoomsBackend(backend RoomsBackend) Option {
+	return func(o *options) {
+		o.rooms = backend
+	}
+}
+
+// WithBroker joins server to a cluster of nodes sharing broker, like SetBroker. Default server isn't in a cluster.
+func WithBroker(broker cluster.Broker) Option {
+	return func(o *options) {
+		o.broker = broker
+	}
+}
+
+// ConfigError is returned by NewServerWithOptions with all invalid options.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "engine.io: invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// NewServerWithOptions returns the server configured by opts. It validates all options, and returns ConfigError if some are invalid, or the error of subscribing to the broker of WithBroker. The config of the returned server is immutable, and its setters, like SetPingTimeout, panic. It can only be replaced as a whole by Reconfigure.
+func NewServerWithOptions(opts ...Option) (*Server, error) {
+	ret, err := newServer(opts)
+	if err != nil {
+		return nil, err
+	}
+	ret.frozen = true
+	return ret, nil
+}
+
+// Reconfigure applies opts to the current config of server, validates it like NewServerWithOptions, and replaces the config atomically. Requests see either the old config or the new one, never a mix of them.
+//
+// New sessions use the new config immediately, and tightened limits, like max connection and max payload, apply to following requests of existing sessions. Existing sessions keep the ping interval and timeout of their handshake, unless existing is true, then they adopt the new ones at their next ping cycle. Clients learn ping interval and timeout only in handshake, so a ping interval longer than before may make existing clients of protocol v4 time out.
+//
+// Transports, session manager, rooms backend and broker can't be changed, and options of them are reported in ConfigError.
+func (s *Server) Reconfigure(existing bool, opts ...Option) error {
+	s.configLocker.Lock()
+	defer s.configLocker.Unlock()
+
+	o := &options{
+		config: s.configure(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var problems []string
+	if o.transports != nil || o.creaters != nil {
+		problems = append(problems, "transports can't be reconfigured")
+	}
+	if o.sessions != nil {
+		problems = append(problems, "session manager can't be reconfigured")
+	}
+	if o.rooms != nil {
+		problems = append(problems, "rooms backend can't be reconfigured")
+	}
+	if o.broker != nil {
+		problems = append(problems, "broker can't be reconfigured")
+	}
+	problems = append(problems, o.config.validate()...)
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	if existing {
+		o.config.pingGeneration++
+	}
+	s.config.Store(&o.config)
+	return nil
+}
+
+func newServer(opts []Option) (*Server, error) {
+	o := &options{
+		config: config{
+			PingTimeout:   60000 * time.Millisecond,
+			PingInterval:  25000 * time.Millisecond,
+			MaxConnection: 1000,
+			AllowRequest:  func(*http.Request) error { return nil },
+			AllowUpgrades: true,
+			Cookie:        DefaultCookieOptions(),
+			NewId:         newId,
+			AllowEIO3:     true,
+			MaxPayload:    1000000,
+			Metrics:       metrics.Nop{},
+		},
+		rooms: NewMemoryRooms(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var problems []string
+	registered := registeredTransports()
+	for _, c := range o.creaters {
+		registered = registered.with(c)
+	}
+	creaters := registered
+	if o.transports != nil {
+		creaters = make(transportCreaters, 0, len(o.transports))
+		for _, t := range o.transports {
+			creater := registered.Get(t)
+			if creater.Name == "" {
+				problems = append(problems, fmt.Sprintf("unknown transport %q", t))
+				continue
+			}
+			creaters = append(creaters, creater)
+		}
+		if len(o.transports) == 0 {
+			problems = append(problems, "no transport")
+		}
+	}
+	problems = append(problems, o.config.validate()...)
+	if o.rooms == nil {
+		problems = append(problems, "rooms backend is nil")
+	}
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+
+	sessions := RangeSessions(newServerSessions())
+	if o.sessions != nil {
+		sessions = AdaptSessions(o.sessions)
+	}
+	ret := &Server{
+		socketChan:     make(chan Conn),
+		serverSessions: sessions,
+		creaters:       creaters,
+		conns:          make(map[string]Conn),
+		closeChan:      make(chan struct{}),
+		idleChan:       make(chan struct{}, 1),
+	}
+	o.config.roomsBackend = o.rooms
+	ret.config.Store(&o.config)
+	ret.rooms = &Rooms{
+		server: ret,
+	}
+	if o.broker != nil {
+		if err := ret.setBroker(o.broker); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// validate returns the problems of c.
+func (c *config) validate() []string {
+	var ret []string
+	if c.PingInterval <= 0 {
+		ret = append(ret, fmt.Sprintf("ping interval %s must be positive", c.PingInterval))
+	}
+	if c.PingTimeout <= 0 {
+		ret = append(ret, fmt.Sprintf("ping timeout %s must be positive", c.PingTimeout))
+	}
+	if c.PingInterval > 0 && c.PingTimeout > 0 && c.PingInterval >= c.PingTimeout {
+		ret = append(ret, fmt.Sprintf("ping interval %s must be shorter than ping timeout %s", c.PingInterval, c.PingTimeout))
+	}
+	if c.MaxConnection <= 0 {
+		ret = append(ret, fmt.Sprintf("max connection %d must be positive", c.MaxConnection))
+	}
+	if c.MaxPayload < 0 {
+		ret = append(ret, fmt.Sprintf("max payload %d must not be negative", c.MaxPayload))
+	}
+	ret = append(ret, c.Cookie.validate()...)
+	ret = append(ret, c.CORS.validate()...)
+	if c.AllowRequest == nil {
+		ret = append(ret, "allow request func is nil")
+	}
+	if c.NewId == nil {
+		ret = append(ret, "new id func is nil")
+	}
+	return ret
+}
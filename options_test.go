@@ -0,0 +1,237 @@
+package engineio
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/cluster"
+	"github.com/teltechsystems/go-engine.io/metrics"
+)
+
+func TestNewServerWithOptions(t *testing.T) {
+	Convey("Defaults", t, func() {
+		server, err := NewServerWithOptions()
+		So(err, ShouldBeNil)
+		So(server.configure().PingInterval, ShouldEqual, 25*time.Second)
+		So(server.configure().PingTimeout, ShouldEqual, 60*time.Second)
+		So(server.configure().MaxConnection, ShouldEqual, 1000)
+		So(server.configure().Cookie.Name, ShouldEqual, "io")
+		So(server.configure().Metrics, ShouldResemble, metrics.Nop{})
+		So(len(server.creaters), ShouldEqual, len(registeredTransports()))
+	})
+
+	Convey("Options", t, func() {
+		sessions := newServerSessions()
+		rooms := NewMemoryRooms()
+		broker := cluster.NewMemoryBroker()
+		server, err := NewServerWithOptions(
+			WithTransports("polling"),
+			WithPingInterval(time.Second),
+			WithPingTimeout(2*time.Second),
+			WithMaxConnection(10),
+			WithAllowUpgrades(false),
+			WithCookie("sid"),
+			WithAllowEIO3(false),
+			WithMaxPayload(0),
+			WithMetrics(nil),
+			WithSessionManager(sessions),
+			WithRoomsBackend(rooms),
+			WithBroker(broker),
+		)
+		So(err, ShouldBeNil)
+		So(len(server.creaters), ShouldEqual, 1)
+		So(server.creaters[0].Name, ShouldEqual, "polling")
+		So(server.configure().PingInterval, ShouldEqual, time.Second)
+		So(server.configure().PingTimeout, ShouldEqual, 2*time.Second)
+		So(server.configure().MaxConnection, ShouldEqual, 10)
+		So(server.configure().AllowUpgrades, ShouldBeFalse)
+		So(server.configure().Cookie.Name, ShouldEqual, "sid")
+		So(server.configure().AllowEIO3, ShouldBeFalse)
+		So(server.configure().MaxPayload, ShouldEqual, 0)
+		So(server.configure().Metrics, ShouldResemble, metrics.Nop{})
+		So(server.Sessions(), ShouldEqual, sessions)
+		So(server.Rooms().backend(), ShouldEqual, rooms)
+		So(server.getBroker().broker, ShouldEqual, broker)
+
+		go server.Accept()
+		req := newOpenReq()
+		req.URL.RawQuery = "EIO=4&transport=polling"
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		So(sessions.Len(), ShouldEqual, 1)
+	})
+
+	Convey("Invalid options", t, func() {
+		_, err := NewServerWithOptions(
+			WithTransports("polling", "fake"),
+			WithPingInterval(time.Minute),
+			WithPingTimeout(time.Second),
+			WithMaxConnection(0),
+			WithMaxPayload(-1),
+			WithCookie("bad cookie"),
+			WithAllowRequest(nil),
+			WithNewId(nil),
+			WithRoomsBackend(nil),
+		)
+		So(err, ShouldResemble, &ConfigError{Problems: []string{
+			`unknown transport "fake"`,
+			"ping interval 1m0s must be shorter than ping timeout 1s",
+			"max connection 0 must be positive",
+			"max payload -1 must not be negative",
+			`invalid cookie name "bad cookie"`,
+			"allow request func is nil",
+			"new id func is nil",
+			"rooms backend is nil",
+		}})
+
+		_, err = NewServerWithOptions(WithTransports(), WithPingInterval(0))
+		So(err.Error(), ShouldEqual, "engine.io: invalid config: no transport; ping interval 0s must be positive")
+
+		_, err = NewServer([]string{"fake"})
+		So(err, ShouldEqual, InvalidError)
+	})
+
+	Convey("Immutable config", t, func() {
+		server, err := NewServerWithOptions()
+		So(err, ShouldBeNil)
+		So(func() { server.SetPingTimeout(time.Second) }, ShouldPanic)
+		So(func() { server.SetMaxConnection(1) }, ShouldPanic)
+		So(func() { server.SetSessionManager(newServerSessions()) }, ShouldPanic)
+		So(func() { server.SetBroker(cluster.NewMemoryBroker()) }, ShouldPanic)
+
+		server, err = NewServer(nil)
+		So(err, ShouldBeNil)
+		So(func() { server.SetPingTimeout(time.Second) }, ShouldNotPanic)
+	})
+}
+
+func TestReconfigure(t *testing.T) {
+	handshake := func(server *Server, eio string) *httptest.ResponseRecorder {
+		req := newOpenReq()
+		req.URL.RawQuery = "EIO=" + eio + "&transport=polling"
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, req)
+		return resp
+	}
+
+	Convey("Limits apply to new sessions", t, func() {
+		server, err := NewServerWithOptions()
+		So(err, ShouldBeNil)
+		go func() {
+			for {
+				if _, err := server.Accept(); err != nil {
+					return
+				}
+			}
+		}()
+		defer server.Shutdown(context.Background())
+
+		So(handshake(server, "3").Code, ShouldEqual, http.StatusOK)
+		So(server.Reconfigure(false, WithMaxConnection(1), WithAllowEIO3(false)), ShouldBeNil)
+		So(server.GetMaxConnection(), ShouldEqual, 1)
+		So(server.Count(), ShouldEqual, 1)
+		So(handshake(server, "4").Code, ShouldEqual, http.StatusServiceUnavailable)
+
+		So(server.Reconfigure(false, WithMaxConnection(2)), ShouldBeNil)
+		So(handshake(server, "3").Code, ShouldEqual, http.StatusBadRequest)
+		So(handshake(server, "4").Code, ShouldEqual, http.StatusOK)
+	})
+
+	Convey("Invalid config is rejected", t, func() {
+		server, err := NewServerWithOptions(WithMaxConnection(10))
+		So(err, ShouldBeNil)
+
+		err = server.Reconfigure(true, WithTransports("polling"), WithSessionManager(newServerSessions()), WithRoomsBackend(NewMemoryRooms()), WithBroker(cluster.NewMemoryBroker()), WithPingInterval(time.Hour))
+		So(err, ShouldResemble, &ConfigError{Problems: []string{
+			"transports can't be reconfigured",
+			"session manager can't be reconfigured",
+			"rooms backend can't be reconfigured",
+			"broker can't be reconfigured",
+			"ping interval 1h0m0s must be shorter than ping timeout 1m0s",
+		}})
+		So(server.configure().PingInterval, ShouldEqual, 25*time.Second)
+		So(server.configure().MaxConnection, ShouldEqual, 10)
+	})
+
+	Convey("Handshake reads config once", t, func() {
+		var server *Server
+		server, err := NewServerWithOptions(WithAllowRequest(func(*http.Request) error {
+			// config changes while handshaking.
+			return server.Reconfigure(false, WithPingInterval(time.Second), WithPingTimeout(2*time.Second), WithMaxPayload(10))
+		}))
+		So(err, ShouldBeNil)
+		go server.Accept()
+		defer server.Shutdown(context.Background())
+
+		resp := handshake(server, "4")
+		So(resp.Code, ShouldEqual, http.StatusOK)
+		// the payload of protocol v4 is the OPEN packet only.
+		body := resp.Body.String()
+		So(body[0], ShouldEqual, '0')
+		open := map[string]interface{}{}
+		So(json.Unmarshal([]byte(body[1:]), &open), ShouldBeNil)
+		So(open["pingInterval"], ShouldEqual, 25000)
+		So(open["pingTimeout"], ShouldEqual, 60000)
+		So(open["maxPayload"], ShouldEqual, 1000000)
+		So(server.configure().PingInterval, ShouldEqual, time.Second)
+	})
+
+	Convey("Ping of existing sessions", t, func() {
+		for _, existing := range []bool{false, true} {
+			server, err := NewServerWithOptions(WithPingInterval(500*time.Millisecond), WithPingTimeout(time.Second))
+			So(err, ShouldBeNil)
+			conns := make(chan Conn, 1)
+			go func() {
+				conn, err := server.Accept()
+				if err == nil {
+					conns <- conn
+				}
+			}()
+			So(handshake(server, "4").Code, ShouldEqual, http.StatusOK)
+			conn := <-conns
+
+			So(server.Reconfigure(existing, WithPingInterval(100*time.Millisecond), WithPingTimeout(200*time.Millisecond)), ShouldBeNil)
+			// client never polls, so the session times out after ping interval and timeout of its ping cycle.
+			time.Sleep(time.Second)
+			if existing {
+				So(conn.(CloseReasonConn).Err(), ShouldNotBeNil)
+				So(conn.(CloseReasonConn).CloseReason(), ShouldEqual, ReasonPingTimeout)
+			} else {
+				So(conn.(CloseReasonConn).Err(), ShouldBeNil)
+			}
+			conn.Close()
+		}
+	})
+
+	Convey("Setters race with requests", t, func() {
+		server, err := NewServer(nil)
+		So(err, ShouldBeNil)
+		go func() {
+			for {
+				if _, err := server.Accept(); err != nil {
+					return
+				}
+			}
+		}()
+		defer server.Shutdown(context.Background())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 100; i++ {
+				server.SetMaxConnection(1000 + i)
+				server.SetPingInterval(time.Second)
+			}
+		}()
+		for i := 0; i < 20; i++ {
+			So(handshake(server, "4").Code, ShouldEqual, http.StatusOK)
+		}
+		<-done
+	})
+}
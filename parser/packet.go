@@ -68,17 +68,24 @@ type PacketEncoder struct {
 
 // NewStringEncoder return the encoder which encode type t to writer w, as string.
 func NewStringEncoder(w io.Writer, t PacketType) (*PacketEncoder, error) {
-	return newEncoder(w, t.Byte()+'0')
+	return newEncoder(w, []byte{t.Byte() + '0'})
 }
 
 // NewBinaryEncoder return the encoder which encode type t to writer w, as binary.
 func NewBinaryEncoder(w io.Writer, t PacketType) (*PacketEncoder, error) {
-	return newEncoder(w, t.Byte())
+	return newEncoder(w, []byte{t.Byte()})
 }
 
-func newEncoder(w io.Writer, t byte) (*PacketEncoder, error) {
-	if _, err := w.Write([]byte{t}); err != nil {
-		return nil, err
+// NewRawEncoder return the encoder which encode binary message to writer w without packet type, as protocol v4 does.
+func NewRawEncoder(w io.Writer) (*PacketEncoder, error) {
+	return newEncoder(w, nil)
+}
+
+func newEncoder(w io.Writer, prefix []byte) (*PacketEncoder, error) {
+	if len(prefix) > 0 {
+		if _, err := w.Write(prefix); err != nil {
+			return nil, err
+		}
 	}
 	closer, ok := w.(io.Closer)
 	if !ok {
@@ -103,6 +110,22 @@ func NewB64Encoder(w io.Writer, t PacketType) (*PacketEncoder, error) {
 	}, nil
 }
 
+// NewV4B64Encoder return the encoder which encode type t to writer w as string of protocol v4. Binary message is encoded as base64 with prefix 'b'.
+func NewV4B64Encoder(w io.Writer, t PacketType) (*PacketEncoder, error) {
+	if t != MESSAGE {
+		// protocol v4 only has binary message, others are sent as string.
+		return NewStringEncoder(w, t)
+	}
+	if _, err := w.Write([]byte{'b'}); err != nil {
+		return nil, err
+	}
+	base := base64.NewEncoder(base64.StdEncoding, w)
+	return &PacketEncoder{
+		closer: base,
+		w:      base,
+	}, nil
+}
+
 // Write writes bytes p.
 func (e *PacketEncoder) Write(p []byte) (int, error) {
 	return e.w.Write(p)
@@ -167,6 +190,20 @@ func NewDecoder(r io.Reader) (*PacketDecoder, error) {
 	return ret, nil
 }
 
+// NewRawDecoder return the decoder which decode binary message without packet type from reader r, as protocol v4 does.
+func NewRawDecoder(r io.Reader) (*PacketDecoder, error) {
+	var closer io.Closer
+	if limit, ok := r.(*limitReader); ok {
+		closer = limit
+	}
+	return &PacketDecoder{
+		closer:  closer,
+		r:       r,
+		t:       MESSAGE,
+		msgType: message.MessageBinary,
+	}, nil
+}
+
 // Read reads packet data to bytes p.
 func (d *PacketDecoder) Read(p []byte) (int, error) {
 	return d.r.Read(p)
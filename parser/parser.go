@@ -1,3 +1,11 @@
 package parser
 
-const Protocol = 3
+const (
+	// ProtocolV3 is the revision 3 of engine.io protocol.
+	ProtocolV3 = 3
+	// ProtocolV4 is the revision 4 of engine.io protocol.
+	ProtocolV4 = 4
+)
+
+// Protocol is the default protocol revision, used when client doesn't specify one.
+const Protocol = ProtocolV3
@@ -3,23 +3,31 @@ package parser
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"strconv"
 	"sync"
+
+	"github.com/teltechsystems/go-engine.io/message"
 )
 
+// recordSeparator separates packets in payload of protocol v4.
+const recordSeparator = 0x1e
+
 // payloadEncoder is the encoder to encode packets as payload. It can be used in multi-thread.
 type PayloadEncoder struct {
 	buffers  [][]byte
 	locker   sync.Mutex
 	isString bool
+	protocol int
 }
 
 // NewStringPayloadEncoder returns the encoder which encode as string.
 func NewStringPayloadEncoder() *PayloadEncoder {
 	return &PayloadEncoder{
 		isString: true,
+		protocol: ProtocolV3,
 	}
 }
 
@@ -27,6 +35,15 @@ func NewStringPayloadEncoder() *PayloadEncoder {
 func NewBinaryPayloadEncoder() *PayloadEncoder {
 	return &PayloadEncoder{
 		isString: false,
+		protocol: ProtocolV3,
+	}
+}
+
+// NewV4PayloadEncoder returns the encoder which encode as protocol v4, packets separated by record separator and binary encoded as base64.
+func NewV4PayloadEncoder() *PayloadEncoder {
+	return &PayloadEncoder{
+		isString: true,
+		protocol: ProtocolV4,
 	}
 }
 
@@ -41,22 +58,50 @@ func (e encoder) Close() error {
 	if err := e.PacketEncoder.Close(); err != nil {
 		return err
 	}
-	var buffer []byte
-	if e.payload.isString {
-		buffer = []byte(fmt.Sprintf("%d:%s", e.buf.Len(), e.buf.String()))
-	} else {
-		buffer = []byte(fmt.Sprintf("%s%d", e.binaryPrefix, e.buf.Len()))
-		for i, n := 0, len(buffer); i < n; i++ {
-			buffer[i] = buffer[i] - '0'
-		}
-		buffer = append(buffer, 0xff)
-		buffer = append(buffer, e.buf.Bytes()...)
+	e.payload.append(e.payload.frame(e.buf.Bytes(), e.binaryPrefix))
+	return nil
+}
+
+// frame returns the encoded packet as a part of payload.
+func (e *PayloadEncoder) frame(packet []byte, binaryPrefix string) []byte {
+	if e.protocol == ProtocolV4 {
+		return packet
 	}
+	if e.isString {
+		return []byte(fmt.Sprintf("%d:%s", len(packet), packet))
+	}
+	buffer := []byte(fmt.Sprintf("%s%d", binaryPrefix, len(packet)))
+	for i, n := 0, len(buffer); i < n; i++ {
+		buffer[i] = buffer[i] - '0'
+	}
+	buffer = append(buffer, 0xff)
+	return append(buffer, packet...)
+}
 
-	e.payload.locker.Lock()
-	e.payload.buffers = append(e.payload.buffers, buffer)
-	e.payload.locker.Unlock()
+func (e *PayloadEncoder) append(buffer []byte) {
+	e.locker.Lock()
+	e.buffers = append(e.buffers, buffer)
+	e.locker.Unlock()
+}
 
+// AppendPrepared appends prepared packet p to payload, reusing its encoding shared with other payloads of the same format.
+func (e *PayloadEncoder) AppendPrepared(p *PreparedPacket) error {
+	encoding, binaryPrefix := EncodingString, "0"
+	if p.MessageType() == message.MessageBinary {
+		binaryPrefix = "1"
+		if e.protocol == ProtocolV4 {
+			encoding = EncodingV4B64
+		} else if e.isString {
+			encoding = EncodingB64
+		} else {
+			encoding = EncodingBinary
+		}
+	}
+	packet, err := p.Encode(encoding)
+	if err != nil {
+		return err
+	}
+	e.append(e.frame(packet, binaryPrefix))
 	return nil
 }
 
@@ -80,7 +125,9 @@ func (e *PayloadEncoder) NextBinary(t PacketType) (io.WriteCloser, error) {
 	buf := bytes.NewBuffer(nil)
 	var pEncoder *PacketEncoder
 	var err error
-	if e.isString {
+	if e.protocol == ProtocolV4 {
+		pEncoder, err = NewV4B64Encoder(buf, t)
+	} else if e.isString {
 		pEncoder, err = NewB64Encoder(buf, t)
 	} else {
 		pEncoder, err = NewBinaryEncoder(buf, t)
@@ -103,7 +150,12 @@ func (e *PayloadEncoder) EncodeTo(w io.Writer) error {
 	e.buffers = nil
 	e.locker.Unlock()
 
-	for _, b := range buffers {
+	for i, b := range buffers {
+		if i > 0 && e.protocol == ProtocolV4 {
+			if _, err := w.Write([]byte{recordSeparator}); err != nil {
+				return err
+			}
+		}
 		for len(b) > 0 {
 			n, err := w.Write(b)
 			if err != nil {
@@ -115,14 +167,27 @@ func (e *PayloadEncoder) EncodeTo(w io.Writer) error {
 	return nil
 }
 
+// Len returns the number of packets waiting to be encoded.
+func (e *PayloadEncoder) Len() int {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+	return len(e.buffers)
+}
+
 //IsString returns true if payload encode to string, otherwise returns false.
 func (e *PayloadEncoder) IsString() bool {
 	return e.isString
 }
 
+// Protocol returns the protocol revision of payload.
+func (e *PayloadEncoder) Protocol() int {
+	return e.protocol
+}
+
 // payloadDecoder is the decoder to decode payload.
 type PayloadDecoder struct {
-	r *bufio.Reader
+	r        *bufio.Reader
+	protocol int
 }
 
 // NewPaylaodDecoder returns the payload decoder which read from reader r.
@@ -132,12 +197,23 @@ func NewPayloadDecoder(r io.Reader) *PayloadDecoder {
 		br = bufio.NewReader(r)
 	}
 	return &PayloadDecoder{
-		r: br,
+		r:        br,
+		protocol: ProtocolV3,
 	}
 }
 
+// NewV4PayloadDecoder returns the payload decoder of protocol v4 which read from reader r.
+func NewV4PayloadDecoder(r io.Reader) *PayloadDecoder {
+	ret := NewPayloadDecoder(r)
+	ret.protocol = ProtocolV4
+	return ret
+}
+
 // Next returns the packet decoder. Make sure it will be closed after used.
 func (d *PayloadDecoder) Next() (*PacketDecoder, error) {
+	if d.protocol == ProtocolV4 {
+		return d.nextV4()
+	}
 	firstByte, err := d.r.Peek(1)
 	if err != nil {
 		return nil, err
@@ -168,3 +244,23 @@ func (d *PayloadDecoder) Next() (*PacketDecoder, error) {
 	}
 	return NewDecoder(newLimitReader(d.r, int(packetLen)))
 }
+
+func (d *PayloadDecoder) nextV4() (*PacketDecoder, error) {
+	line, err := d.r.ReadBytes(recordSeparator)
+	if err == io.EOF {
+		if len(line) == 0 {
+			return nil, io.EOF
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		line = line[:len(line)-1]
+	}
+	if len(line) == 0 {
+		return nil, fmt.Errorf("invalid input")
+	}
+	if line[0] == 'b' {
+		return NewRawDecoder(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(line[1:])))
+	}
+	return NewDecoder(bytes.NewReader(line))
+}
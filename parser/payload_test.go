@@ -3,10 +3,12 @@ package parser
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"runtime"
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/message"
 )
 
 func TestStringPayload(t *testing.T) {
@@ -171,6 +173,103 @@ func TestBinaryPayload(t *testing.T) {
 	}
 }
 
+func TestV4Payload(t *testing.T) {
+	type packet struct {
+		Type     PacketType
+		Data     []byte
+		IsString bool
+	}
+	type Test struct {
+		name    string
+		packets []packet
+		output  string
+	}
+	var tests = []Test{
+		{"spec text", []packet{packet{MESSAGE, []byte("hello"), true}, packet{MESSAGE, []byte("€"), true}}, "4hello\x1e4€"},
+		{"spec binary", []packet{packet{MESSAGE, []byte("€"), true}, packet{MESSAGE, []byte{1, 2, 3, 4}, false}}, "4€\x1ebAQIDBA=="},
+		{"spec probe", []packet{packet{PING, []byte("probe"), true}, packet{PONG, []byte("probe"), true}}, "2probe\x1e3probe"},
+		{"control", []packet{packet{PING, nil, true}, packet{NOOP, nil, false}, packet{CLOSE, nil, true}}, "2\x1e6\x1e1"},
+		{"single", []packet{packet{MESSAGE, []byte("测试"), false}}, "b5rWL6K+V"},
+	}
+	for _, test := range tests {
+		buf := bytes.NewBuffer(nil)
+
+		Convey("Given an array of packet "+test.name, t, func() {
+
+			Convey("Create encoder", func() {
+				encoder := NewV4PayloadEncoder()
+				So(encoder.IsString(), ShouldBeTrue)
+				So(encoder.Protocol(), ShouldEqual, ProtocolV4)
+
+				Convey("Encoded", func() {
+					for _, p := range test.packets {
+						var e io.WriteCloser
+						var err error
+						if p.IsString {
+							e, err = encoder.NextString(p.Type)
+						} else {
+							e, err = encoder.NextBinary(p.Type)
+						}
+						So(err, ShouldBeNil)
+						for d := p.Data; len(d) > 0; {
+							n, err := e.Write(d)
+							So(err, ShouldBeNil)
+							d = d[n:]
+						}
+						err = e.Close()
+						So(err, ShouldBeNil)
+					}
+
+					Convey("End", func() {
+						err := encoder.EncodeTo(buf)
+						So(err, ShouldBeNil)
+						So(buf.String(), ShouldEqual, test.output)
+					})
+				})
+			})
+
+			Convey("Create decoder", func() {
+				decoder := NewV4PayloadDecoder(buf)
+
+				Convey("Decode", func() {
+					i := 0
+					for ; ; i++ {
+						d, err := decoder.Next()
+						if err == io.EOF {
+							break
+						}
+						So(err, ShouldBeNil)
+						So(d.Type(), ShouldEqual, test.packets[i].Type)
+						if test.packets[i].Type == MESSAGE && !test.packets[i].IsString {
+							So(d.MessageType(), ShouldEqual, message.MessageBinary)
+						} else {
+							So(d.MessageType(), ShouldEqual, message.MessageText)
+						}
+
+						b, err := ioutil.ReadAll(d)
+						So(err, ShouldBeNil)
+						So(len(b), ShouldEqual, len(test.packets[i].Data))
+						if len(b) > 0 {
+							So(b, ShouldResemble, test.packets[i].Data)
+						}
+						err = d.Close()
+						So(err, ShouldBeNil)
+					}
+					So(i, ShouldEqual, len(test.packets))
+				})
+			})
+		})
+	}
+
+	Convey("Decode invalid v4 payload", t, func() {
+		decoder := NewV4PayloadDecoder(bytes.NewBufferString("4a\x1e\x1e4b"))
+		_, err := decoder.Next()
+		So(err, ShouldBeNil)
+		_, err = decoder.Next()
+		So(err, ShouldNotBeNil)
+	})
+}
+
 func TestParallelEncode(t *testing.T) {
 	prev := runtime.GOMAXPROCS(10)
 	defer runtime.GOMAXPROCS(prev)
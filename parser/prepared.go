@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/teltechsystems/go-engine.io/message"
+)
+
+// Encoding is the way to encode a packet, like NewStringEncoder or NewB64Encoder does.
+type Encoding int
+
+const (
+	EncodingString Encoding = iota
+	EncodingBinary
+	EncodingB64
+	EncodingV4B64
+	EncodingRaw
+)
+
+// PreparedPacket is a packet which caches its encodings, so it's encoded only once for each encoding when it's sent to many connections. It can be used in multi-thread.
+type PreparedPacket struct {
+	t       PacketType
+	msgType message.MessageType
+	data    []byte
+	locker  sync.Mutex
+	encoded map[Encoding][]byte
+}
+
+// NewPreparedPacket returns the prepared packet with type t and data of message type msgType.
+func NewPreparedPacket(msgType message.MessageType, t PacketType, data []byte) *PreparedPacket {
+	return &PreparedPacket{
+		t:       t,
+		msgType: msgType,
+		data:    data,
+		encoded: make(map[Encoding][]byte),
+	}
+}
+
+// Type returns the packet type.
+func (p *PreparedPacket) Type() PacketType {
+	return p.t
+}
+
+// MessageType returns the message type of data.
+func (p *PreparedPacket) MessageType() message.MessageType {
+	return p.msgType
+}
+
+// Data returns the data without encoding.
+func (p *PreparedPacket) Data() []byte {
+	return p.data
+}
+
+// Encode returns the packet encoded by encoding e. The returned bytes are shared, and must not be modified.
+func (p *PreparedPacket) Encode(e Encoding) ([]byte, error) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if ret, ok := p.encoded[e]; ok {
+		return ret, nil
+	}
+	buf := bytes.NewBuffer(nil)
+	var encoder *PacketEncoder
+	var err error
+	switch e {
+	case EncodingString:
+		encoder, err = NewStringEncoder(buf, p.t)
+	case EncodingBinary:
+		encoder, err = NewBinaryEncoder(buf, p.t)
+	case EncodingB64:
+		encoder, err = NewB64Encoder(buf, p.t)
+	case EncodingV4B64:
+		encoder, err = NewV4B64Encoder(buf, p.t)
+	case EncodingRaw:
+		encoder, err = NewRawEncoder(buf)
+	default:
+		err = fmt.Errorf("invalid encoding %d", e)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := encoder.Write(p.data); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	p.encoded[e] = buf.Bytes()
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/message"
+)
+
+func TestPreparedPacket(t *testing.T) {
+	Convey("Encode prepared packet", t, func() {
+		data := []byte("测试")
+		p := NewPreparedPacket(message.MessageBinary, MESSAGE, data)
+		So(p.Type(), ShouldEqual, MESSAGE)
+		So(p.MessageType(), ShouldEqual, message.MessageBinary)
+		So(p.Data(), ShouldResemble, data)
+
+		for encoding, newEncoder := range map[Encoding]func(io.Writer, PacketType) (*PacketEncoder, error){
+			EncodingString: NewStringEncoder,
+			EncodingBinary: NewBinaryEncoder,
+			EncodingB64:    NewB64Encoder,
+			EncodingV4B64:  NewV4B64Encoder,
+			EncodingRaw: func(w io.Writer, t PacketType) (*PacketEncoder, error) {
+				return NewRawEncoder(w)
+			},
+		} {
+			buf := bytes.NewBuffer(nil)
+			e, err := newEncoder(buf, MESSAGE)
+			So(err, ShouldBeNil)
+			e.Write(data)
+			e.Close()
+
+			b, err := p.Encode(encoding)
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, buf.Bytes())
+			again, _ := p.Encode(encoding)
+			So(&again[0], ShouldEqual, &b[0])
+		}
+
+		_, err := p.Encode(Encoding(100))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Append prepared packet to payload", t, func() {
+		for name, newPayload := range map[string]func() *PayloadEncoder{
+			"string": NewStringPayloadEncoder,
+			"binary": NewBinaryPayloadEncoder,
+			"v4":     NewV4PayloadEncoder,
+		} {
+			Convey(name, func() {
+				expect, actual := newPayload(), newPayload()
+				for _, msgType := range []message.MessageType{message.MessageText, message.MessageBinary} {
+					next := expect.NextString
+					if msgType == message.MessageBinary {
+						next = expect.NextBinary
+					}
+					w, err := next(MESSAGE)
+					So(err, ShouldBeNil)
+					w.Write([]byte("hello"))
+					w.Close()
+
+					err = actual.AppendPrepared(NewPreparedPacket(msgType, MESSAGE, []byte("hello")))
+					So(err, ShouldBeNil)
+				}
+				So(actual.Len(), ShouldEqual, 2)
+
+				expectBuf, actualBuf := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
+				expect.EncodeTo(expectBuf)
+				actual.EncodeTo(actualBuf)
+				So(actualBuf.Bytes(), ShouldResemble, expectBuf.Bytes())
+				So(actual.Len(), ShouldEqual, 0)
+			})
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/teltechsystems/go-engine.io/message"
@@ -19,17 +20,23 @@ type client struct {
 	url            url.URL
 	seq            uint
 	getResp        *http.Response
-	postResp       *http.Response
 	resp           *http.Response
 	payloadDecoder *parser.PayloadDecoder
 	payloadEncoder *parser.PayloadEncoder
 	client         *http.Client
 	state          state
+	stateLocker    sync.Mutex
+	reqLocker      sync.Mutex
+	protocol       int
+	pauseChan      chan struct{}
 }
 
 func NewClient(r *http.Request) (transport.Client, error) {
+	protocol := transport.Protocol(r)
 	newEncoder := parser.NewBinaryPayloadEncoder
-	if _, ok := r.URL.Query()["b64"]; ok {
+	if protocol == parser.ProtocolV4 {
+		newEncoder = parser.NewV4PayloadEncoder
+	} else if _, ok := r.URL.Query()["b64"]; ok {
 		newEncoder = parser.NewStringPayloadEncoder
 	}
 	ret := &client{
@@ -39,18 +46,19 @@ func NewClient(r *http.Request) (transport.Client, error) {
 		payloadEncoder: newEncoder(),
 		client:         http.DefaultClient,
 		state:          stateNormal,
+		protocol:       protocol,
 	}
 	return ret, nil
 }
 
 func (c *client) Response() *http.Response {
+	c.reqLocker.Lock()
+	defer c.reqLocker.Unlock()
 	return c.resp
 }
 
+// NextReader returns the next packet of last polling response. If there is no more, it polls again unless client is closed.
 func (c *client) NextReader() (*parser.PacketDecoder, error) {
-	if c.state != stateNormal {
-		return nil, io.EOF
-	}
 	if c.payloadDecoder != nil {
 		ret, err := c.payloadDecoder.Next()
 		if err != io.EOF {
@@ -59,6 +67,12 @@ func (c *client) NextReader() (*parser.PacketDecoder, error) {
 		c.getResp.Body.Close()
 		c.payloadDecoder = nil
 	}
+	if pause := c.getPause(); pause != nil {
+		<-pause
+	}
+	if c.getState() != stateNormal {
+		return nil, io.EOF
+	}
 	req := c.getReq()
 	req.Method = "GET"
 	var err error
@@ -66,15 +80,22 @@ func (c *client) NextReader() (*parser.PacketDecoder, error) {
 	if err != nil {
 		return nil, err
 	}
-	if c.resp == nil {
-		c.resp = c.getResp
+	c.setResp(c.getResp)
+	if c.getResp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(c.getResp.Body)
+		c.getResp.Body.Close()
+		return nil, fmt.Errorf("poll failed: %s", bytes.TrimSpace(b))
+	}
+	if c.protocol == parser.ProtocolV4 {
+		c.payloadDecoder = parser.NewV4PayloadDecoder(c.getResp.Body)
+	} else {
+		c.payloadDecoder = parser.NewPayloadDecoder(c.getResp.Body)
 	}
-	c.payloadDecoder = parser.NewPayloadDecoder(c.getResp.Body)
 	return c.payloadDecoder.Next()
 }
 
 func (c *client) NextWriter(messageType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
-	if c.state != stateNormal {
+	if c.getState() != stateNormal {
 		return nil, io.EOF
 	}
 	next := c.payloadEncoder.NextBinary
@@ -89,14 +110,61 @@ func (c *client) NextWriter(messageType message.MessageType, packetType parser.P
 }
 
 func (c *client) Close() error {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
 	if c.state != stateNormal {
 		return nil
 	}
 	c.state = stateClosed
+	if c.pauseChan != nil {
+		close(c.pauseChan)
+		c.pauseChan = nil
+	}
 	return nil
 }
 
+// Pause stops polling after the current request, until Resume or Close is called. It's called while probing an upgrade, so no request is sent after server switches to the new transport.
+func (c *client) Pause() {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	if c.state == stateNormal && c.pauseChan == nil {
+		c.pauseChan = make(chan struct{})
+	}
+}
+
+// Resume continues polling stopped by Pause.
+func (c *client) Resume() {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	if c.pauseChan != nil {
+		close(c.pauseChan)
+		c.pauseChan = nil
+	}
+}
+
+func (c *client) getPause() chan struct{} {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	return c.pauseChan
+}
+
+func (c *client) getState() state {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	return c.state
+}
+
+func (c *client) setResp(resp *http.Response) {
+	c.reqLocker.Lock()
+	defer c.reqLocker.Unlock()
+	if c.resp == nil {
+		c.resp = resp
+	}
+}
+
 func (c *client) getReq() *http.Request {
+	c.reqLocker.Lock()
+	defer c.reqLocker.Unlock()
 	req := c.req
 	url := c.url
 	req.URL = &url
@@ -108,7 +176,7 @@ func (c *client) getReq() *http.Request {
 }
 
 func (c *client) doPost() error {
-	if c.state != stateNormal {
+	if c.getState() != stateNormal {
 		return io.EOF
 	}
 	req := c.getReq()
@@ -118,13 +186,15 @@ func (c *client) doPost() error {
 		return err
 	}
 	req.Body = ioutil.NopCloser(buf)
-	var err error
-	c.postResp, err = c.client.Do(req)
+	resp, err := c.client.Do(req)
 	if err != nil {
 		return err
 	}
-	if c.resp == nil {
-		c.resp = c.postResp
+	defer resp.Body.Close()
+	c.setResp(resp)
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("post failed: %s", bytes.TrimSpace(b))
 	}
 	return nil
 }
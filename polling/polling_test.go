@@ -204,6 +204,78 @@ func TestPolling(t *testing.T) {
 		client.Close()
 	})
 
+	Convey("Normal v4", t, func() {
+		s := newServer()
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		req, err := http.NewRequest("GET", server.URL+"?EIO=4", nil)
+		So(err, ShouldBeNil)
+		client, err := NewClient(req)
+		So(err, ShouldBeNil)
+
+		sync := make(chan int)
+
+		go func() {
+			<-s.callback.onPacket
+			sync <- 1
+		}()
+
+		{
+			w, err := client.NextWriter(message.MessageBinary, parser.MESSAGE)
+			So(err, ShouldBeNil)
+			_, err = w.Write([]byte{1, 2, 3, 4})
+			So(err, ShouldBeNil)
+			err = w.Close()
+			So(err, ShouldBeNil)
+		}
+
+		{
+			<-sync
+			So(s.callback.messageType, ShouldEqual, message.MessageBinary)
+			So(s.callback.packetType, ShouldEqual, parser.MESSAGE)
+			So(s.callback.body, ShouldResemble, []byte{1, 2, 3, 4})
+		}
+
+		{
+			w, err := s.server.NextWriter(message.MessageText, parser.MESSAGE)
+			So(err, ShouldBeNil)
+			_, err = w.Write([]byte("hello"))
+			So(err, ShouldBeNil)
+			err = w.Close()
+			So(err, ShouldBeNil)
+
+			w, err = s.server.NextWriter(message.MessageBinary, parser.MESSAGE)
+			So(err, ShouldBeNil)
+			_, err = w.Write([]byte{5, 6})
+			So(err, ShouldBeNil)
+			err = w.Close()
+			So(err, ShouldBeNil)
+		}
+
+		{
+			r, err := client.NextReader()
+			So(err, ShouldBeNil)
+			So(r.MessageType(), ShouldEqual, message.MessageText)
+			b, err := ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, []byte("hello"))
+			err = r.Close()
+			So(err, ShouldBeNil)
+
+			r, err = client.NextReader()
+			So(err, ShouldBeNil)
+			So(r.MessageType(), ShouldEqual, message.MessageBinary)
+			b, err = ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, []byte{5, 6})
+			err = r.Close()
+			So(err, ShouldBeNil)
+		}
+
+		client.Close()
+	})
+
 }
 
 type server struct {
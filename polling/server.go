@@ -6,8 +6,10 @@ import (
 	"io"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/metrics"
 	"github.com/teltechsystems/go-engine.io/parser"
 	"github.com/teltechsystems/go-engine.io/transport"
 )
@@ -25,35 +27,50 @@ type Polling struct {
 	sendChan    chan bool
 	encoder     *parser.PayloadEncoder
 	callback    transport.Callback
+	metrics     metrics.Metrics
 	getLocker   *Locker
 	postLocker  *Locker
 	state       state
 	stateLocker sync.Mutex
+	protocol    int
 }
 
 func NewServer(w http.ResponseWriter, r *http.Request, callback transport.Callback) (transport.Server, error) {
+	protocol := transport.Protocol(r)
 	newEncoder := parser.NewBinaryPayloadEncoder
-	if r.URL.Query()["b64"] != nil {
+	if protocol == parser.ProtocolV4 {
+		newEncoder = parser.NewV4PayloadEncoder
+	} else if r.URL.Query()["b64"] != nil {
 		newEncoder = parser.NewStringPayloadEncoder
 	}
 	ret := &Polling{
 		sendChan:   MakeSendChan(),
 		encoder:    newEncoder(),
 		callback:   callback,
+		metrics:    transport.MetricsOf(callback),
 		getLocker:  NewLocker(),
 		postLocker: NewLocker(),
 		state:      stateNormal,
+		protocol:   protocol,
 	}
 	return ret, nil
 }
 
 func (p *Polling) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recorder := &responseRecorder{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
 	switch r.Method {
 	case "GET":
-		p.get(w, r)
+		p.get(recorder, r)
+		if recorder.status == http.StatusOK {
+			p.metrics.PayloadSize("polling", metrics.Out, recorder.size)
+		}
 	case "POST":
-		p.post(w, r)
+		p.post(recorder, r)
 	}
+	p.metrics.PollingRequest(r.Method, recorder.status)
 }
 
 func (p *Polling) Close() error {
@@ -93,6 +110,26 @@ func (p *Polling) NextWriter(msgType message.MessageType, packetType parser.Pack
 	return NewWriter(ret, p), nil
 }
 
+// WritePrepared queues prepared packet p, reusing its encoding shared with other pollings of the same format. Queueing never blocks, so deadline is ignored.
+func (p *Polling) WritePrepared(packet *parser.PreparedPacket, deadline time.Time) error {
+	if p.getState() != stateNormal {
+		return io.EOF
+	}
+	if err := p.encoder.AppendPrepared(packet); err != nil {
+		return err
+	}
+	select {
+	case p.sendChan <- true:
+	default:
+	}
+	return nil
+}
+
+// Buffered returns the number of packets waiting for next GET request.
+func (p *Polling) Buffered() int {
+	return p.encoder.Len()
+}
+
 func (p *Polling) get(w http.ResponseWriter, r *http.Request) {
 	if !p.getLocker.TryLock() {
 		http.Error(w, "overlay get", http.StatusBadRequest)
@@ -159,21 +196,30 @@ func (p *Polling) post(w http.ResponseWriter, r *http.Request) {
 		p.postLocker.Unlock()
 	}()
 
-	var decoder *parser.PayloadDecoder
+	newDecoder := parser.NewPayloadDecoder
+	if p.protocol == parser.ProtocolV4 {
+		newDecoder = parser.NewV4PayloadDecoder
+	}
+	body := &countReader{}
+	defer func() {
+		p.metrics.PayloadSize("polling", metrics.In, body.n)
+	}()
 	if j := r.URL.Query().Get("j"); j != "" {
 		// JSONP Polling
 		d := r.FormValue("d")
-		decoder = parser.NewPayloadDecoder(bytes.NewBufferString(d))
+		body.Reader = bytes.NewBufferString(d)
 	} else {
 		// XHR Polling
-		decoder = parser.NewPayloadDecoder(r.Body)
+		body.Reader = r.Body
 	}
+	decoder := newDecoder(body)
 	for {
 		d, err := decoder.Next()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
+			transport.ReportError(p.callback, p, err)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
@@ -195,3 +241,32 @@ func (p *Polling) getState() state {
 	defer p.stateLocker.Unlock()
 	return p.state
 }
+
+// responseRecorder records the status and body size of response for metrics.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.size += n
+	return n, err
+}
+
+type countReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
@@ -233,6 +233,63 @@ func TestServer(t *testing.T) {
 			}
 		})
 
+		Convey("Get and post v4", func() {
+			f := newFakeCallback()
+			w := httptest.NewRecorder()
+			r, err := http.NewRequest("GET", "/?EIO=4", nil)
+			So(err, ShouldBeNil)
+
+			server, err := NewServer(w, r, f)
+			So(err, ShouldBeNil)
+
+			{
+				writer, err := server.NextWriter(message.MessageText, parser.MESSAGE)
+				So(err, ShouldBeNil)
+				_, err = writer.Write([]byte("测试"))
+				So(err, ShouldBeNil)
+				err = writer.Close()
+				So(err, ShouldBeNil)
+
+				writer, err = server.NextWriter(message.MessageBinary, parser.MESSAGE)
+				So(err, ShouldBeNil)
+				_, err = writer.Write([]byte{1, 2, 3, 4})
+				So(err, ShouldBeNil)
+				err = writer.Close()
+				So(err, ShouldBeNil)
+
+				w := httptest.NewRecorder()
+				r, err := http.NewRequest("GET", "/", nil)
+				So(err, ShouldBeNil)
+
+				server.ServeHTTP(w, r)
+
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Header().Get("Content-Type"), ShouldEqual, "text/plain; charset=UTF-8")
+				So(w.Body.String(), ShouldEqual, "4测试\x1ebAQIDBA==")
+			}
+
+			go func() {
+				<-f.onPacket
+			}()
+
+			{
+				w := httptest.NewRecorder()
+				r, err := http.NewRequest("POST", "/", bytes.NewBufferString("bAQIDBA=="))
+				So(err, ShouldBeNil)
+
+				server.ServeHTTP(w, r)
+
+				So(w.Code, ShouldEqual, http.StatusOK)
+				So(w.Body.String(), ShouldEqual, "ok")
+				So(f.packetType, ShouldEqual, parser.MESSAGE)
+				So(f.messageType, ShouldEqual, message.MessageBinary)
+				So(f.body, ShouldResemble, []byte{1, 2, 3, 4})
+			}
+
+			err = server.Close()
+			So(err, ShouldBeNil)
+		})
+
 		Convey("Post", func() {
 			f := newFakeCallback()
 			w := httptest.NewRecorder()
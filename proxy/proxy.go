@@ -0,0 +1,156 @@
+// Package proxy is a sticky-session reverse proxy for engine.io servers.
+//
+// Requests of a session are sent to the backend which owns it, by sid query parameter or the cookie set by engineio.Server. The owner of a session is learned from the cookie of the handshake response. New handshakes are spread to backends by consistent hash of the client address, and websocket upgrades are proxied to the owner like other requests. Requests of sessions which proxy doesn't know, like after it restarted or when another proxy replica got the handshake, are routed by the same hash, so they reach the backend of the handshake.
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoBackend is returned by New when no backend is given.
+var ErrNoBackend = errors.New("no backend")
+
+type owner struct {
+	backend  string
+	lastSeen time.Time
+}
+
+// Proxy routes engine.io requests to backends. Setters must be called before serving.
+type Proxy struct {
+	ring     *Ring
+	backends map[string]*httputil.ReverseProxy
+	cookie   string
+	timeout  time.Duration
+	hashKey  func(r *http.Request) string
+
+	locker  sync.Mutex
+	owners  map[string]*owner
+	sweptAt time.Time
+}
+
+// New returns the proxy of backends, which are urls like "http://10.0.0.1:5000".
+func New(backends ...string) (*Proxy, error) {
+	if len(backends) == 0 {
+		return nil, ErrNoBackend
+	}
+	ret := &Proxy{
+		ring:     NewRing(DefaultReplicas, backends...),
+		backends: make(map[string]*httputil.ReverseProxy),
+		cookie:   "io",
+		timeout:  2 * time.Minute,
+		hashKey:  ClientIP,
+		owners:   make(map[string]*owner),
+		sweptAt:  time.Now(),
+	}
+	for _, backend := range backends {
+		u, err := url.Parse(backend)
+		if err != nil {
+			return nil, err
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, errors.New("invalid backend " + backend)
+		}
+		p := httputil.NewSingleHostReverseProxy(u)
+		backend := backend
+		p.ModifyResponse = func(resp *http.Response) error {
+			ret.learn(backend, resp)
+			return nil
+		}
+		ret.backends[backend] = p
+	}
+	return ret, nil
+}
+
+// SetCookie sets the name of cookie which backends set with sid. Default is "io", like engineio.Server. Backends must not disable the cookie, or proxy can't learn the owners of sessions.
+func (p *Proxy) SetCookie(name string) {
+	p.cookie = name
+}
+
+// SetSessionTimeout sets how long the owner of a session is kept after its last request. It should be longer than ping interval plus ping timeout of backends. Default is 2 minutes.
+func (p *Proxy) SetSessionTimeout(t time.Duration) {
+	p.timeout = t
+}
+
+// SetHashKey sets the function which returns the key of handshake requests, to pick a backend by consistent hash. Default is ClientIP.
+func (p *Proxy) SetHashKey(f func(r *http.Request) string) {
+	p.hashKey = f
+}
+
+// Backend returns the backend which r is sent to.
+func (p *Proxy) Backend(r *http.Request) string {
+	sid := p.sid(r)
+	if sid == "" {
+		return p.ring.Get(p.hashKey(r))
+	}
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	if o, ok := p.owners[sid]; ok {
+		o.lastSeen = time.Now()
+		return o.backend
+	}
+	// unknown session, like after proxy restarted or handshaked by another proxy. The same client hashes to the backend of its handshake.
+	return p.ring.Get(p.hashKey(r))
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.backends[p.Backend(r)].ServeHTTP(w, r)
+}
+
+func (p *Proxy) sid(r *http.Request) string {
+	if sid := r.URL.Query().Get("sid"); sid != "" {
+		return sid
+	}
+	if c, err := r.Cookie(p.cookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// learn records backend as the owner of sid in the cookie of resp.
+func (p *Proxy) learn(backend string, resp *http.Response) {
+	for _, c := range resp.Cookies() {
+		if c.Name != p.cookie || c.Value == "" {
+			continue
+		}
+		now := time.Now()
+		p.locker.Lock()
+		p.owners[c.Value] = &owner{
+			backend:  backend,
+			lastSeen: now,
+		}
+		if now.Sub(p.sweptAt) > p.timeout {
+			p.sweep(now)
+		}
+		p.locker.Unlock()
+	}
+}
+
+// sweep removes owners which aren't seen in timeout. It must be called with locker held.
+func (p *Proxy) sweep(now time.Time) {
+	for sid, o := range p.owners {
+		if now.Sub(o.lastSeen) > p.timeout {
+			delete(p.owners, sid)
+		}
+	}
+	p.sweptAt = now
+}
+
+// ClientIP returns the address of client of r, which is the first address in X-Forwarded-For header if it exists, or the host of r.RemoteAddr.
+func ClientIP(r *http.Request) string {
+	if f := r.Header.Get("X-Forwarded-For"); f != "" {
+		return strings.TrimSpace(strings.Split(f, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
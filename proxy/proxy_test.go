@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	engineio "github.com/teltechsystems/go-engine.io"
+	"github.com/teltechsystems/go-engine.io/transport"
+	"github.com/teltechsystems/go-engine.io/websocket"
+)
+
+func newEchoBackend() (*engineio.Server, *httptest.Server) {
+	server, _ := engineio.NewServer(nil)
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					t, r, err := conn.NextReader()
+					if err != nil {
+						return
+					}
+					b, _ := ioutil.ReadAll(r)
+					r.Close()
+					w, err := conn.NextWriter(t)
+					if err != nil {
+						return
+					}
+					w.Write(b)
+					w.Close()
+				}
+			}()
+		}
+	}()
+	return server, httptest.NewServer(server)
+}
+
+func echo(conn engineio.Conn, data string) string {
+	w, err := conn.NextWriter(engineio.MessageText)
+	So(err, ShouldBeNil)
+	w.Write([]byte(data))
+	So(w.Close(), ShouldBeNil)
+
+	_, r, err := conn.NextReader()
+	So(err, ShouldBeNil)
+	b, err := ioutil.ReadAll(r)
+	So(err, ShouldBeNil)
+	r.Close()
+	return string(b)
+}
+
+func TestRing(t *testing.T) {
+	Convey("Empty ring", t, func() {
+		So(NewRing(0).Get("key"), ShouldEqual, "")
+	})
+
+	Convey("Keys keep their node", t, func() {
+		r3 := NewRing(0, "a", "b", "c")
+		r2 := NewRing(0, "a", "b")
+		count := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key%d", i)
+			node := r3.Get(key)
+			So(r3.Get(key), ShouldEqual, node)
+			count[node]++
+			if node != "c" {
+				So(r2.Get(key), ShouldEqual, node)
+			}
+		}
+		So(len(count), ShouldEqual, 3)
+		for _, n := range count {
+			So(n, ShouldBeGreaterThan, 100)
+		}
+	})
+}
+
+func TestProxy(t *testing.T) {
+	Convey("Invalid backends", t, func() {
+		_, err := New()
+		So(err, ShouldEqual, ErrNoBackend)
+		_, err = New("localhost")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Sessions stick to their backend", t, func() {
+		server1, backend1 := newEchoBackend()
+		defer backend1.Close()
+		server2, backend2 := newEchoBackend()
+		defer backend2.Close()
+
+		p, err := New(backend1.URL, backend2.URL)
+		So(err, ShouldBeNil)
+		var n int64
+		p.SetHashKey(func(r *http.Request) string {
+			return fmt.Sprintf("client%d", atomic.AddInt64(&n, 1))
+		})
+		front := httptest.NewServer(p)
+		defer front.Close()
+
+		for _, opts := range []*engineio.DialOptions{
+			{DisableUpgrades: true},
+			{Transports: []transport.Creater{websocket.Creater}},
+			nil,
+		} {
+			for i := 0; i < 4; i++ {
+				conn, err := engineio.Dial(front.URL, opts)
+				So(err, ShouldBeNil)
+				for j := 0; j < 3; j++ {
+					data := fmt.Sprintf("%d-%d", i, j)
+					So(echo(conn, data), ShouldEqual, data)
+				}
+
+				owner := server1
+				if p.Backend(httptest.NewRequest("GET", "/?sid="+conn.Id(), nil)) == backend2.URL {
+					owner = server2
+				}
+				So(owner.Sessions().Get(conn.Id()) != nil, ShouldBeTrue)
+				conn.Close()
+			}
+		}
+	})
+
+	Convey("Route by cookie", t, func() {
+		var hits [2]int64
+		backends := make([]*httptest.Server, 2)
+		for i := range backends {
+			i := i
+			backends[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt64(&hits[i], 1)
+				http.SetCookie(w, &http.Cookie{Name: "io", Value: fmt.Sprintf("sid%d", i)})
+			}))
+			defer backends[i].Close()
+		}
+
+		p, err := New(backends[0].URL, backends[1].URL)
+		So(err, ShouldBeNil)
+		p.SetSessionTimeout(time.Minute)
+		front := httptest.NewServer(p)
+		defer front.Close()
+
+		resp, err := http.Get(front.URL)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+		cookies := resp.Cookies()
+		So(len(cookies), ShouldEqual, 1)
+		i := 0
+		if cookies[0].Value == "sid1" {
+			i = 1
+		}
+
+		for j := 0; j < 5; j++ {
+			req, _ := http.NewRequest("GET", front.URL, nil)
+			req.AddCookie(cookies[0])
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+		}
+		So(atomic.LoadInt64(&hits[i]), ShouldEqual, 6)
+		So(atomic.LoadInt64(&hits[1-i]), ShouldEqual, 0)
+	})
+
+	Convey("Unknown sessions reach the backend of handshake", t, func() {
+		_, backend1 := newEchoBackend()
+		defer backend1.Close()
+		_, backend2 := newEchoBackend()
+		defer backend2.Close()
+
+		p1, err := New(backend1.URL, backend2.URL)
+		So(err, ShouldBeNil)
+		front1 := httptest.NewServer(p1)
+		defer front1.Close()
+		// another replica, which doesn't know sessions of p1.
+		p2, err := New(backend1.URL, backend2.URL)
+		So(err, ShouldBeNil)
+		front2 := httptest.NewServer(p2)
+		defer front2.Close()
+
+		for i := 0; i < 8; i++ {
+			client := fmt.Sprintf("10.0.0.%d", i)
+			req, _ := http.NewRequest("GET", front1.URL+"/?EIO=4&transport=polling", nil)
+			req.Header.Set("X-Forwarded-For", client)
+			resp, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			b, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+			var open struct {
+				Sid string `json:"sid"`
+			}
+			So(json.Unmarshal(b[1:], &open), ShouldBeNil)
+
+			req, _ = http.NewRequest("POST", front2.URL+"/?EIO=4&transport=polling&sid="+open.Sid, strings.NewReader("4hello"))
+			req.Header.Set("X-Forwarded-For", client)
+			resp, err = http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is the number of points of each node on Ring, if NewRing is called with replicas <= 0.
+const DefaultReplicas = 100
+
+// Ring is a consistent hash ring of nodes. Adding or removing a node only moves the keys near its points, so most keys keep their node. It's read-only after NewRing, and can be used in multi-thread.
+type Ring struct {
+	hashes []uint32
+	nodes  map[uint32]string
+}
+
+// NewRing returns the ring of nodes, with replicas points for each node.
+func NewRing(replicas int, nodes ...string) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	ret := &Ring{
+		nodes: make(map[uint32]string),
+	}
+	for _, node := range nodes {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + node))
+			if _, ok := ret.nodes[h]; ok {
+				continue
+			}
+			ret.nodes[h] = node
+			ret.hashes = append(ret.hashes, h)
+		}
+	}
+	sort.Slice(ret.hashes, func(i, j int) bool { return ret.hashes[i] < ret.hashes[j] })
+	return ret
+}
+
+// Get returns the node of key, or "" if ring is empty.
+func (r *Ring) Get(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
@@ -0,0 +1,433 @@
+package engineio
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var QueueFullError = errors.New("write queue is full")
+
+var DisconnectedError = errors.New("disconnected")
+
+// ReconnectOptions is the options of DialReconnect.
+type ReconnectOptions struct {
+	DialOptions
+
+	// MaxAttempts is the max attempts of one reconnection. Zero means retry forever.
+	MaxAttempts int
+
+	// Delay is the delay before first attempt, doubled for each following attempt. Default is 1s.
+	Delay time.Duration
+
+	// MaxDelay is the max delay between attempts. Default is 30s.
+	MaxDelay time.Duration
+
+	// Jitter randomizes the delay by the given ratio, between 0 and 1. Default is 0.5. Negative disables jitter, so delays are deterministic, like in tests, and ratio above 1 is taken as 1.
+	Jitter float64
+
+	// QueueSize is the max number of messages queued while disconnected. They are sent after reconnected. Zero disables queue, and NextWriter returns DisconnectedError while disconnected.
+	QueueSize int
+
+	// OnReconnecting is called before each attempt.
+	OnReconnecting func(attempt int)
+
+	// OnReconnected is called when reconnected with the new connection.
+	OnReconnected func(conn Conn, attempt int)
+
+	// OnGiveUp is called when it stops reconnecting after MaxAttempts.
+	OnGiveUp func(err error)
+}
+
+type queuedMessage struct {
+	t    MessageType
+	data []byte
+}
+
+type reconnectConn struct {
+	url       string
+	options   ReconnectOptions
+	locker    sync.Mutex
+	conn      Conn
+	lastConn  Conn
+	ready     chan struct{}
+	queue     []queuedMessage
+	reserved  int
+	sending   int
+	err       error
+	closed    bool
+	closeChan chan struct{}
+}
+
+// DialReconnect connects to the engine.io server at url u like Dial, and returns the connection which reconnects when it's lost. If the first connection fails, it returns the error without retrying.
+func DialReconnect(u string, opts *ReconnectOptions) (Conn, error) {
+	if opts == nil {
+		opts = &ReconnectOptions{}
+	}
+	options := *opts
+	if options.Delay <= 0 {
+		options.Delay = time.Second
+	}
+	if options.MaxDelay <= 0 {
+		options.MaxDelay = 30 * time.Second
+	}
+	switch {
+	case options.Jitter == 0:
+		options.Jitter = 0.5
+	case options.Jitter < 0:
+		options.Jitter = 0
+	case options.Jitter > 1:
+		options.Jitter = 1
+	}
+	conn, err := Dial(u, &options.DialOptions)
+	if err != nil {
+		return nil, err
+	}
+	ready := make(chan struct{})
+	close(ready)
+	ret := &reconnectConn{
+		url:       u,
+		options:   options,
+		conn:      conn,
+		lastConn:  conn,
+		ready:     ready,
+		closeChan: make(chan struct{}),
+	}
+	go ret.watch(conn)
+	return ret, nil
+}
+
+// Id returns the session id of current connection. It changes after reconnected.
+func (c *reconnectConn) Id() string {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.lastConn.Id()
+}
+
+func (c *reconnectConn) Request() *http.Request {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	return c.lastConn.Request()
+}
+
+func (c *reconnectConn) Close() error {
+	c.locker.Lock()
+	if c.closed {
+		c.locker.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.closeChan)
+	conn := c.conn
+	c.locker.Unlock()
+
+	if conn != nil {
+		return conn.Close()
+	}
+	return nil
+}
+
+// Err returns *CloseError after the connection is closed or given up reconnecting, or nil otherwise. The error of giving up is in CloseError.Err.
+func (c *reconnectConn) Err() error {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.closed {
+		return &CloseError{Reason: ReasonClientClose}
+	}
+	if c.err != nil {
+		return &CloseError{
+			Reason: closeReason(c.lastConn),
+			Err:    c.err,
+		}
+	}
+	return nil
+}
+
+// CloseReason returns the reason why last connection is closed.
+func (c *reconnectConn) CloseReason() DisconnectReason {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.closed {
+		return ReasonClientClose
+	}
+	return closeReason(c.lastConn)
+}
+
+// Stats returns the statistics of current connection. They start over after reconnected, and are zero if the connection isn't StatsConn.
+func (c *reconnectConn) Stats() Stats {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if conn, ok := c.lastConn.(StatsConn); ok {
+		return conn.Stats()
+	}
+	return Stats{}
+}
+
+// NextReader returns the next message. It waits for reconnection if connection is lost, and returns error after closed or given up.
+func (c *reconnectConn) NextReader() (MessageType, io.ReadCloser, error) {
+	return c.NextReaderContext(context.Background())
+}
+
+// NextReaderContext is like NextReader, but returns ctx.Err() if ctx is done before a message is received, including waiting for reconnection.
+func (c *reconnectConn) NextReaderContext(ctx context.Context) (MessageType, io.ReadCloser, error) {
+	for {
+		conn, err := c.wait(ctx)
+		if err != nil {
+			return MessageBinary, nil, err
+		}
+		t, r, err := nextReaderContext(ctx, conn)
+		if err == nil {
+			return t, r, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return MessageBinary, nil, err
+		}
+		c.lost(conn)
+	}
+}
+
+// NextWriter returns the writer of next message. When disconnected, the message is queued if queue is enabled.
+func (c *reconnectConn) NextWriter(t MessageType) (io.WriteCloser, error) {
+	return c.NextWriterContext(context.Background(), t)
+}
+
+func (c *reconnectConn) NextWriterContext(ctx context.Context, t MessageType) (io.WriteCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.locker.Lock()
+	if c.closed {
+		c.locker.Unlock()
+		return nil, io.EOF
+	}
+	if c.err != nil {
+		c.locker.Unlock()
+		return nil, c.err
+	}
+	conn := c.conn
+	if conn == nil {
+		defer c.locker.Unlock()
+		return c.queueWriter(t)
+	}
+	c.locker.Unlock()
+
+	w, err := nextWriterContext(ctx, conn, t)
+	if err == nil {
+		return w, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.lost(conn)
+
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.closed {
+		return nil, io.EOF
+	}
+	return c.queueWriter(t)
+}
+
+// queueWriter should be called with locker held.
+func (c *reconnectConn) queueWriter(t MessageType) (io.WriteCloser, error) {
+	if c.options.QueueSize <= 0 {
+		return nil, DisconnectedError
+	}
+	if len(c.queue)+c.reserved+c.sending >= c.options.QueueSize {
+		return nil, QueueFullError
+	}
+	c.reserved++
+	return &queueWriter{
+		conn: c,
+		t:    t,
+	}, nil
+}
+
+func (c *reconnectConn) wait(ctx context.Context) (Conn, error) {
+	for {
+		c.locker.Lock()
+		conn, ready, err, closed := c.conn, c.ready, c.err, c.closed
+		c.locker.Unlock()
+		if closed {
+			return nil, io.EOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if conn != nil {
+			return conn, nil
+		}
+		select {
+		case <-ready:
+		case <-c.closeChan:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (c *reconnectConn) lost(conn Conn) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if c.closed || c.conn != conn {
+		return
+	}
+	c.conn = nil
+	c.ready = make(chan struct{})
+	go c.reconnect(c.ready)
+}
+
+func (c *reconnectConn) reconnect(ready chan struct{}) {
+	var lastErr error
+	for attempt := 1; c.options.MaxAttempts <= 0 || attempt <= c.options.MaxAttempts; attempt++ {
+		if f := c.options.OnReconnecting; f != nil {
+			f(attempt)
+		}
+		select {
+		case <-time.After(c.backoff(attempt)):
+		case <-c.closeChan:
+			return
+		}
+		conn, err := Dial(c.url, &c.options.DialOptions)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := c.flush(conn, ready); err != nil {
+			conn.Close()
+			lastErr = err
+			continue
+		}
+		if f := c.options.OnReconnected; f != nil {
+			f(conn, attempt)
+		}
+		return
+	}
+
+	err := fmt.Errorf("gave up reconnecting after %d attempts: %s", c.options.MaxAttempts, lastErr)
+	c.locker.Lock()
+	c.err = err
+	c.queue = nil
+	close(ready)
+	c.locker.Unlock()
+	if f := c.options.OnGiveUp; f != nil {
+		f(err)
+	}
+}
+
+// flush sends queued messages with conn, and sets conn as current connection if succeeded. Messages are written without locker held, and ones queued meanwhile are sent before conn is set.
+func (c *reconnectConn) flush(conn Conn, ready chan struct{}) error {
+	for {
+		c.locker.Lock()
+		c.sending = 0
+		if c.closed {
+			c.locker.Unlock()
+			return io.EOF
+		}
+		queue := c.queue
+		if len(queue) == 0 {
+			c.conn = conn
+			c.lastConn = conn
+			close(ready)
+			go c.watch(conn)
+			c.locker.Unlock()
+			return nil
+		}
+		c.queue = nil
+		c.sending = len(queue)
+		c.locker.Unlock()
+
+		for i, m := range queue {
+			if err := writeMessage(conn, m.t, m.data); err != nil {
+				c.locker.Lock()
+				c.sending = 0
+				// unsent messages are before the ones queued while sending.
+				c.queue = append(queue[i:len(queue):len(queue)], c.queue...)
+				c.locker.Unlock()
+				return err
+			}
+		}
+	}
+}
+
+// watch starts reconnecting as soon as conn is closed, without waiting for reading or writing.
+func (c *reconnectConn) watch(conn Conn) {
+	cc, ok := conn.(*clientConn)
+	if !ok {
+		return
+	}
+	select {
+	case <-cc.closeChan:
+		c.lost(conn)
+	case <-c.closeChan:
+	}
+}
+
+func (c *reconnectConn) backoff(attempt int) time.Duration {
+	delay := c.options.Delay
+	for i := 1; i < attempt && delay < c.options.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.options.MaxDelay {
+		delay = c.options.MaxDelay
+	}
+	if c.options.Jitter > 0 {
+		delay += time.Duration((rand.Float64()*2 - 1) * c.options.Jitter * float64(delay))
+	}
+	return delay
+}
+
+type queueWriter struct {
+	bytes.Buffer
+	conn   *reconnectConn
+	t      MessageType
+	closed bool
+}
+
+func (w *queueWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	c := w.conn
+	c.locker.Lock()
+	c.reserved--
+	if c.closed {
+		c.locker.Unlock()
+		return io.EOF
+	}
+	if c.err != nil {
+		c.locker.Unlock()
+		return c.err
+	}
+	if conn := c.conn; conn != nil {
+		// reconnected before closing writer.
+		c.locker.Unlock()
+		return writeMessage(conn, w.t, w.Bytes())
+	}
+	c.queue = append(c.queue, queuedMessage{
+		t:    w.t,
+		data: w.Bytes(),
+	})
+	c.locker.Unlock()
+	return nil
+}
+
+func writeMessage(conn Conn, t MessageType, data []byte) error {
+	w, err := conn.NextWriter(t)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -0,0 +1,267 @@
+package engineio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type restartHandler struct {
+	locker sync.Mutex
+	server *Server
+	down   bool
+	conns  []Conn
+}
+
+func newRestartHandler() *restartHandler {
+	ret := &restartHandler{}
+	ret.start()
+	return ret
+}
+
+func (h *restartHandler) start() {
+	server, _ := NewServer(nil)
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			h.locker.Lock()
+			h.conns = append(h.conns, conn)
+			h.locker.Unlock()
+			go func() {
+				for {
+					t, r, err := conn.NextReader()
+					if err != nil {
+						return
+					}
+					b, _ := ioutil.ReadAll(r)
+					r.Close()
+					writeMessage(conn, t, b)
+				}
+			}()
+		}
+	}()
+	h.locker.Lock()
+	h.server = server
+	h.down = false
+	h.locker.Unlock()
+}
+
+func (h *restartHandler) stop() {
+	h.locker.Lock()
+	conns := h.conns
+	h.conns = nil
+	h.down = true
+	h.locker.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+func (h *restartHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.locker.Lock()
+	server, down := h.server, h.down
+	h.locker.Unlock()
+	if down {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	server.ServeHTTP(w, r)
+}
+
+// slowConn blocks every writer until it's released.
+type slowConn struct {
+	Conn
+	writing chan MessageType
+	release chan error
+	written bytes.Buffer
+}
+
+func newSlowConn() *slowConn {
+	return &slowConn{
+		writing: make(chan MessageType),
+		release: make(chan error),
+	}
+}
+
+func (c *slowConn) NextWriter(t MessageType) (io.WriteCloser, error) {
+	c.writing <- t
+	if err := <-c.release; err != nil {
+		return nil, err
+	}
+	return writeCloser{&c.written}, nil
+}
+
+func TestDialReconnect(t *testing.T) {
+	Convey("Reconnect", t, func() {
+		h := newRestartHandler()
+		hs := httptest.NewServer(h)
+		defer hs.Close()
+
+		reconnecting := make(chan int, 10)
+		reconnected := make(chan int, 10)
+		gaveUp := make(chan error, 1)
+		options := &ReconnectOptions{
+			DialOptions: DialOptions{
+				DisableUpgrades: true,
+			},
+			Delay:     time.Second / 10,
+			MaxDelay:  time.Second / 5,
+			QueueSize: 2,
+			OnReconnecting: func(attempt int) {
+				reconnecting <- attempt
+			},
+			OnReconnected: func(conn Conn, attempt int) {
+				reconnected <- attempt
+			},
+			OnGiveUp: func(err error) {
+				gaveUp <- err
+			},
+		}
+
+		Convey("after server restart with queued messages", func() {
+			conn, err := DialReconnect(hs.URL, options)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			id := conn.Id()
+
+			readChan := make(chan string, 10)
+			go func() {
+				for {
+					_, r, err := conn.NextReader()
+					if err != nil {
+						close(readChan)
+						return
+					}
+					b, _ := ioutil.ReadAll(r)
+					r.Close()
+					readChan <- string(b)
+				}
+			}()
+
+			h.stop()
+			So(<-reconnecting, ShouldEqual, 1)
+
+			So(writeMessage(conn, MessageText, []byte("queued1")), ShouldBeNil)
+			So(writeMessage(conn, MessageText, []byte("queued2")), ShouldBeNil)
+			_, err = conn.NextWriter(MessageText)
+			So(err, ShouldEqual, QueueFullError)
+
+			h.start()
+			<-reconnected
+			So(conn.Id(), ShouldNotEqual, id)
+			So(<-readChan, ShouldEqual, "queued1")
+			So(<-readChan, ShouldEqual, "queued2")
+
+			So(writeMessage(conn, MessageText, []byte("hello")), ShouldBeNil)
+			So(<-readChan, ShouldEqual, "hello")
+		})
+
+		Convey("give up after max attempts", func() {
+			options.MaxAttempts = 2
+			options.QueueSize = 0
+			conn, err := DialReconnect(hs.URL, options)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			h.stop()
+			So(<-reconnecting, ShouldEqual, 1)
+			_, err = conn.NextWriter(MessageText)
+			So(err, ShouldEqual, DisconnectedError)
+
+			_, _, err = conn.NextReader()
+			So(err, ShouldNotBeNil)
+			So(err, ShouldEqual, <-gaveUp)
+			So(len(reconnecting), ShouldEqual, 1)
+			So(len(reconnected), ShouldEqual, 0)
+
+			_, err = conn.NextWriter(MessageText)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("backoff", func() {
+			c := &reconnectConn{options: ReconnectOptions{
+				Delay:    time.Second,
+				MaxDelay: 10 * time.Second,
+				Jitter:   0.5,
+			}}
+			So(c.backoff(1), ShouldBeBetweenOrEqual, time.Second/2, time.Second*3/2)
+			So(c.backoff(3), ShouldBeBetweenOrEqual, 2*time.Second, 6*time.Second)
+			So(c.backoff(10), ShouldBeBetweenOrEqual, 5*time.Second, 15*time.Second)
+
+			c.options.Jitter = -1
+			So(c.backoff(1), ShouldEqual, time.Second)
+			So(c.backoff(3), ShouldEqual, 4*time.Second)
+			So(c.backoff(10), ShouldEqual, 10*time.Second)
+		})
+
+		Convey("jitter above 1", func() {
+			conn, err := DialReconnect(hs.URL, &ReconnectOptions{Jitter: 3})
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			c := conn.(*reconnectConn)
+			So(c.options.Jitter, ShouldEqual, 1)
+			for i := 0; i < 100; i++ {
+				So(c.backoff(1), ShouldBeGreaterThanOrEqualTo, 0)
+			}
+		})
+	})
+
+	Convey("Flush queued messages", t, func() {
+		c := &reconnectConn{
+			options:   ReconnectOptions{QueueSize: 3},
+			closeChan: make(chan struct{}),
+			queue: []queuedMessage{
+				{t: MessageText, data: []byte("1")},
+				{t: MessageText, data: []byte("2")},
+			},
+		}
+		conn := newSlowConn()
+		ready := make(chan struct{})
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- c.flush(conn, ready)
+		}()
+		<-conn.writing
+
+		// messages can be queued while flushing.
+		So(writeMessage(c, MessageText, []byte("3")), ShouldBeNil)
+		_, err := c.NextWriter(MessageText)
+		So(err, ShouldEqual, QueueFullError)
+
+		Convey("sends messages queued meanwhile", func() {
+			for i := 0; i < 2; i++ {
+				conn.release <- nil
+				<-conn.writing
+			}
+			conn.release <- nil
+			So(<-errChan, ShouldBeNil)
+			<-ready
+			So(conn.written.String(), ShouldEqual, "123")
+			So(c.conn, ShouldEqual, conn)
+		})
+
+		Convey("requeues unsent messages", func() {
+			conn.release <- nil
+			<-conn.writing
+			conn.release <- errors.New("lost")
+			So(<-errChan, ShouldNotBeNil)
+			So(c.conn, ShouldBeNil)
+			data := []string{}
+			for _, m := range c.queue {
+				data = append(data, string(m.data))
+			}
+			So(data, ShouldResemble, []string{"2", "3"})
+		})
+	})
+}
@@ -0,0 +1,183 @@
+package engineio
+
+import (
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/teltechsystems/go-engine.io/cluster"
+)
+
+// RoomsBackend stores the membership of rooms by session id. Methods are called concurrently. It can be shared by servers of different nodes, and Rooms of each server only sends to its local sessions.
+type RoomsBackend interface {
+	// Join adds session sid to room.
+	Join(room, sid string) error
+
+	// Leave removes session sid from room.
+	Leave(room, sid string) error
+
+	// LeaveAll removes session sid from all rooms.
+	LeaveAll(sid string) error
+
+	// Members returns the session ids in room.
+	Members(room string) ([]string, error)
+
+	// Rooms returns the rooms which session sid is in.
+	Rooms(sid string) ([]string, error)
+}
+
+// Rooms groups sessions of server by name. Sessions leave all rooms when they are closed.
+type Rooms struct {
+	server *Server
+}
+
+// backend returns the backend of current config, which SetRoomsBackend may replace.
+func (r *Rooms) backend() RoomsBackend {
+	return r.server.configure().roomsBackend
+}
+
+// Join adds conn to room. It returns io.EOF if conn is closed.
+func (r *Rooms) Join(conn Conn, room string) error {
+	if connErr(conn) != nil {
+		return io.EOF
+	}
+	backend := r.backend()
+	if err := backend.Join(room, conn.Id()); err != nil {
+		return err
+	}
+	if connErr(conn) != nil {
+		// closed while joining, which may be after it left all rooms.
+		backend.LeaveAll(conn.Id())
+		return io.EOF
+	}
+	return nil
+}
+
+// Leave removes conn from room.
+func (r *Rooms) Leave(conn Conn, room string) error {
+	return r.backend().Leave(room, conn.Id())
+}
+
+// Members returns the session ids in room, including sessions of other nodes if backend is shared.
+func (r *Rooms) Members(room string) ([]string, error) {
+	return r.backend().Members(room)
+}
+
+// RoomsOf returns the rooms which conn is in.
+func (r *Rooms) RoomsOf(conn Conn) ([]string, error) {
+	return r.backend().Rooms(conn.Id())
+}
+
+// Send sends payload as a message of messageType to the sessions in room, like Server.Broadcast does. If server has a broker, the message is also published to other nodes, which send it to their own sessions in room.
+func (r *Rooms) Send(room string, messageType MessageType, payload []byte) error {
+	err := r.sendLocal(room, messageType, payload)
+	if perr := r.server.publish(cluster.ToRoom, room, messageType, payload); err == nil {
+		err = perr
+	}
+	return err
+}
+
+// sendLocal sends the message to the sessions of this server in room.
+func (r *Rooms) sendLocal(room string, messageType MessageType, payload []byte) error {
+	members, err := r.backend().Members(room)
+	if err != nil {
+		return err
+	}
+	return fanOut(messageType, payload, func(f func(id string, conn Conn) bool) {
+		for _, id := range members {
+			conn := r.server.serverSessions.Get(id)
+			if conn == nil {
+				continue
+			}
+			if !f(id, conn) {
+				return
+			}
+		}
+	})
+}
+
+type memoryRooms struct {
+	locker  sync.RWMutex
+	members map[string]map[string]struct{}
+	rooms   map[string]map[string]struct{}
+}
+
+// NewMemoryRooms returns the RoomsBackend which stores membership in memory of the process. It's the default backend of server.
+func NewMemoryRooms() RoomsBackend {
+	return &memoryRooms{
+		members: make(map[string]map[string]struct{}),
+		rooms:   make(map[string]map[string]struct{}),
+	}
+}
+
+func (m *memoryRooms) Join(room, sid string) error {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	setAdd(m.members, room, sid)
+	setAdd(m.rooms, sid, room)
+	return nil
+}
+
+func (m *memoryRooms) Leave(room, sid string) error {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	setRemove(m.members, room, sid)
+	setRemove(m.rooms, sid, room)
+	return nil
+}
+
+func (m *memoryRooms) LeaveAll(sid string) error {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	for room := range m.rooms[sid] {
+		setRemove(m.members, room, sid)
+	}
+	delete(m.rooms, sid)
+	return nil
+}
+
+func (m *memoryRooms) Members(room string) ([]string, error) {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+
+	return setKeys(m.members[room]), nil
+}
+
+func (m *memoryRooms) Rooms(sid string) ([]string, error) {
+	m.locker.RLock()
+	defer m.locker.RUnlock()
+
+	return setKeys(m.rooms[sid]), nil
+}
+
+func setAdd(m map[string]map[string]struct{}, key, value string) {
+	set, ok := m[key]
+	if !ok {
+		set = make(map[string]struct{})
+		m[key] = set
+	}
+	set[value] = struct{}{}
+}
+
+func setRemove(m map[string]map[string]struct{}, key, value string) {
+	set, ok := m[key]
+	if !ok {
+		return
+	}
+	delete(set, value)
+	if len(set) == 0 {
+		delete(m, key)
+	}
+}
+
+func setKeys(set map[string]struct{}) []string {
+	ret := make([]string, 0, len(set))
+	for k := range set {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,114 @@
+package engineio
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMemoryRooms(t *testing.T) {
+	Convey("Memory rooms", t, func() {
+		rooms := NewMemoryRooms()
+		So(rooms.Join("a", "1"), ShouldBeNil)
+		So(rooms.Join("a", "2"), ShouldBeNil)
+		So(rooms.Join("b", "1"), ShouldBeNil)
+
+		members, err := rooms.Members("a")
+		So(err, ShouldBeNil)
+		So(members, ShouldResemble, []string{"1", "2"})
+		joined, err := rooms.Rooms("1")
+		So(err, ShouldBeNil)
+		So(joined, ShouldResemble, []string{"a", "b"})
+
+		So(rooms.Leave("a", "2"), ShouldBeNil)
+		members, _ = rooms.Members("a")
+		So(members, ShouldResemble, []string{"1"})
+
+		So(rooms.LeaveAll("1"), ShouldBeNil)
+		members, _ = rooms.Members("a")
+		So(members, ShouldBeEmpty)
+		members, _ = rooms.Members("b")
+		So(members, ShouldBeEmpty)
+		joined, _ = rooms.Rooms("1")
+		So(joined, ShouldBeEmpty)
+	})
+}
+
+func TestRooms(t *testing.T) {
+	Convey("Rooms of server", t, func() {
+		server, h := newEchoServer()
+		defer h.Close()
+		events := newHookEvents(server)
+		rooms := server.Rooms()
+
+		clients := make([]Conn, 3)
+		conns := make([]Conn, 3)
+		for i := range clients {
+			var err error
+			clients[i], err = Dial(h.URL, &DialOptions{DisableUpgrades: true})
+			So(err, ShouldBeNil)
+			defer clients[i].Close()
+			conns[i] = <-events.connections
+		}
+		So(rooms.Join(conns[0], "lobby"), ShouldBeNil)
+		So(rooms.Join(conns[1], "lobby"), ShouldBeNil)
+		So(rooms.Join(conns[2], "other"), ShouldBeNil)
+
+		joined, err := rooms.RoomsOf(conns[0])
+		So(err, ShouldBeNil)
+		So(joined, ShouldResemble, []string{"lobby"})
+		members, err := rooms.Members("lobby")
+		So(err, ShouldBeNil)
+		So(len(members), ShouldEqual, 2)
+
+		Convey("send to room", func() {
+			So(rooms.Send("lobby", MessageText, []byte("hello")), ShouldBeNil)
+			for _, client := range clients[:2] {
+				_, r, err := client.NextReader()
+				So(err, ShouldBeNil)
+				b, _ := ioutil.ReadAll(r)
+				r.Close()
+				So(string(b), ShouldEqual, "hello")
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_, _, err := clients[2].(ContextConn).NextReaderContext(ctx)
+			So(err, ShouldResemble, context.DeadlineExceeded)
+		})
+
+		Convey("leave", func() {
+			So(rooms.Leave(conns[1], "lobby"), ShouldBeNil)
+			members, _ := rooms.Members("lobby")
+			So(members, ShouldResemble, []string{conns[0].Id()})
+		})
+
+		Convey("leave all when closed", func() {
+			conns[0].Close()
+			So(events.disconnect(), ShouldEqual, ReasonServerClose)
+			members, _ := rooms.Members("lobby")
+			So(members, ShouldResemble, []string{conns[1].Id()})
+			So(rooms.Join(conns[0], "lobby"), ShouldEqual, io.EOF)
+		})
+
+		Convey("set backend while joining", func() {
+			backend := NewMemoryRooms()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 100; i++ {
+					rooms.Join(conns[2], "race")
+				}
+			}()
+			server.SetRoomsBackend(backend)
+			<-done
+			So(rooms.backend(), ShouldEqual, backend)
+			So(rooms.Join(conns[0], "new"), ShouldBeNil)
+			members, _ := backend.Members("new")
+			So(members, ShouldResemble, []string{conns[0].Id()})
+		})
+	})
+}
@@ -2,15 +2,19 @@ package engineio
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/teltechsystems/go-engine.io/polling"
-	"github.com/teltechsystems/go-engine.io/websocket"
+	"github.com/teltechsystems/go-engine.io/metrics"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
 )
 
 type config struct {
@@ -19,69 +23,82 @@ type config struct {
 	MaxConnection int
 	AllowRequest  func(*http.Request) error
 	AllowUpgrades bool
-	Cookie        string
+	Cookie        CookieOptions
+	CORS          CORSOptions
 	NewId         func(r *http.Request) string
+	AllowEIO3     bool
+	MaxPayload    int64
+	Hooks         Hooks
+	Metrics       metrics.Metrics
+
+	// roomsBackend stores the membership of rooms.
+	roomsBackend RoomsBackend
+
+	// pingGeneration changes when ping of existing sessions is reconfigured.
+	pingGeneration uint64
 }
 
+var ErrServerClosed = errors.New("engine.io: Server closed")
+
 // Server is the server of engine.io.
 type Server struct {
-	config            config
+	config            atomic.Value // *config
+	configLocker      sync.Mutex
 	socketChan        chan Conn
-	serverSessions    Sessions
+	serverSessions    RangeSessions
 	creaters          transportCreaters
 	currentConnection int32
+	conns             map[string]Conn
+	connsLocker       sync.Mutex
+	closed            bool
+	closeChan         chan struct{}
+	idleChan          chan struct{}
+	rooms             *Rooms
+	broker            atomic.Value // *brokerLink
+	brokerLocker      sync.Mutex
+	frozen            bool
 }
 
-// NewServer returns the server suppported given transports. If transports is nil, server will use ["polling", "websocket"] as default.
+// NewServer returns the server suppported given transports, which are registered by RegisterTransport. If transports is nil, server will use all registered transports, ["polling", "websocket"] by default.
+//
+// It's kept for compatibility, the config of the returned server can be changed by setters. NewServerWithOptions validates the config and makes it immutable.
 func NewServer(transports []string) (*Server, error) {
-	if transports == nil {
-		transports = []string{"polling", "websocket"}
-	}
-	creaters := make(transportCreaters)
-	for _, t := range transports {
-		switch t {
-		case "polling":
-			creaters[t] = polling.Creater
-		case "websocket":
-			creaters[t] = websocket.Creater
-		default:
-			return nil, InvalidError
-		}
+	var opts []Option
+	if transports != nil {
+		opts = append(opts, WithTransports(transports...))
+	}
+	ret, err := newServer(opts)
+	if err != nil {
+		// only transports can be invalid, keep the error of old versions.
+		return nil, InvalidError
 	}
-	return &Server{
-		config: config{
-			PingTimeout:   60000 * time.Millisecond,
-			PingInterval:  25000 * time.Millisecond,
-			MaxConnection: 1000,
-			AllowRequest:  func(*http.Request) error { return nil },
-			AllowUpgrades: true,
-			Cookie:        "io",
-			NewId:         newId,
-		},
-		socketChan:     make(chan Conn),
-		serverSessions: newServerSessions(),
-		creaters:       creaters,
-	}, nil
+	return ret, nil
 }
 
 // SetPingTimeout sets the timeout of ping. When time out, server will close connection. Default is 60s.
 func (s *Server) SetPingTimeout(t time.Duration) {
-	s.config.PingTimeout = t
+	s.update("SetPingTimeout", func(c *config) {
+		c.PingTimeout = t
+	})
 }
 
 // SetPingInterval sets the interval of ping. Default is 25s.
 func (s *Server) SetPingInterval(t time.Duration) {
-	s.config.PingInterval = t
+	s.update("SetPingInterval", func(c *config) {
+		c.PingInterval = t
+	})
 }
 
 // SetMaxConnection sets the max connetion. Default is 1000.
 func (s *Server) SetMaxConnection(n int) {
-	s.config.MaxConnection = n
+	s.update("SetMaxConnection", func(c *config) {
+		c.MaxConnection = n
+	})
 }
 
 // GetMaxConnection returns the current max connection
 func (s *Server) GetMaxConnection() int {
-	return s.config.MaxConnection
+	return s.configure().MaxConnection
 }
 
 // Count returns a count of current number of active connections in session
@@ -91,32 +108,134 @@ func (s *Server) Count() int {
 
 // SetAllowRequest sets the middleware function when establish connection. If it return non-nil, connection won't be established. Default will allow all request.
 func (s *Server) SetAllowRequest(f func(*http.Request) error) {
-	s.config.AllowRequest = f
+	s.update("SetAllowRequest", func(c *config) {
+		c.AllowRequest = f
+	})
 }
 
 // SetAllowUpgrades sets whether server allows transport upgrade. Default is true.
 func (s *Server) SetAllowUpgrades(allow bool) {
-	s.config.AllowUpgrades = allow
+	s.update("SetAllowUpgrades", func(c *config) {
+		c.AllowUpgrades = allow
+	})
 }
 
 // SetCookie sets the name of cookie which used by engine.io. Default is "io".
 func (s *Server) SetCookie(prefix string) {
-	s.config.Cookie = prefix
+	s.update("SetCookie", func(c *config) {
+		c.Cookie.Name = prefix
+	})
+}
+
+// SetCookieOptions sets the cookie which server sets with sid in handshake response. Default is DefaultCookieOptions().
+func (s *Server) SetCookieOptions(cookie CookieOptions) {
+	s.update("SetCookieOptions", func(c *config) {
+		c.Cookie = cookie
+	})
+}
+
+// SetCORS sets the options of cross-origin requests. CORS is disabled by default.
+func (s *Server) SetCORS(cors CORSOptions) {
+	s.update("SetCORS", func(c *config) {
+		c.CORS = cors
+	})
 }
 
 // SetNewId sets the callback func to generate new connection id. By default, id is generated from remote addr + current time stamp
 func (s *Server) SetNewId(f func(*http.Request) string) {
-	s.config.NewId = f
+	s.update("SetNewId", func(c *config) {
+		c.NewId = f
+	})
+}
+
+// SetAllowEIO3 sets whether server accepts clients of engine.io protocol v3. Default is true.
+func (s *Server) SetAllowEIO3(allow bool) {
+	s.update("SetAllowEIO3", func(c *config) {
+		c.AllowEIO3 = allow
+	})
+}
+
+// SetMaxPayload sets the max bytes of payload which client can post in one request. It is sent to protocol v4 clients in handshake. Default is 1MB.
+func (s *Server) SetMaxPayload(n int64) {
+	s.update("SetMaxPayload", func(c *config) {
+		c.MaxPayload = n
+	})
 }
 
-// SetSessionManager sets the sessions as server's session manager. Default sessions is single process manager. You can custom it as load balance.
+// SetHooks sets the callbacks of connection lifecycle.
+func (s *Server) SetHooks(hooks Hooks) {
+	s.update("SetHooks", func(c *config) {
+		c.Hooks = hooks
+	})
+}
+
+// SetMetrics sets the collector which server and transports report metrics to. Default discards all metrics.
+func (s *Server) SetMetrics(m metrics.Metrics) {
+	if m == nil {
+		m = metrics.Nop{}
+	}
+	s.update("SetMetrics", func(c *config) {
+		c.Metrics = m
+	})
+}
+
+// SetRoomsBackend sets the backend which stores membership of rooms. Default backend stores it in memory.
+func (s *Server) SetRoomsBackend(backend RoomsBackend) {
+	s.update("SetRoomsBackend", func(c *config) {
+		c.roomsBackend = backend
+	})
+}
+
+// update changes config by f, like a setter. It panics if config of s is immutable.
+func (s *Server) update(setter string, f func(c *config)) {
+	s.mustMutate(setter)
+	s.configLocker.Lock()
+	defer s.configLocker.Unlock()
+
+	c := s.configure()
+	f(&c)
+	s.config.Store(&c)
+}
+
+// mustMutate panics if config of s is immutable.
+func (s *Server) mustMutate(setter string) {
+	if s.frozen {
+		panic("engine.io: " + setter + " is called on the server of NewServerWithOptions, whose config is immutable")
+	}
+}
+
+// Rooms returns the rooms of server's sessions.
+func (s *Server) Rooms() *Rooms {
+	return s.rooms
+}
+
+// SetSessionManager sets the sessions as server's session manager. Default sessions is single process manager. You can custom it as load balance. If sessions doesn't implement RangeSessions, it's adapted by AdaptSessions.
 func (s *Server) SetSessionManager(sessions Sessions) {
-	s.serverSessions = sessions
+	s.mustMutate("SetSessionManager")
+	s.serverSessions = AdaptSessions(sessions)
+}
+
+// Sessions returns the session manager of server.
+func (s *Server) Sessions() RangeSessions {
+	return s.serverSessions
 }
 
 // ServeHTTP handles http request.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	defer r.Body.Close()
+	if r.Method != "CONNECT" {
+		// body of CONNECT request is the stream of tunneled transport, like webtransport session.
+		defer r.Body.Close()
+	}
+
+	cfg := s.configure()
+	if cfg.CORS.enabled() {
+		cfg.CORS.setHeaders(w, r)
+	}
+	if r.Method == "OPTIONS" {
+		// preflight request, which never starts a session or reaches transports.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
 
 	sid := r.URL.Query().Get("sid")
 	conn := s.serverSessions.Get(sid)
@@ -126,46 +245,155 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if err := s.config.AllowRequest(r); err != nil {
+		m := cfg.Metrics
+
+		if s.isClosed() {
+			m.Handshake(metrics.HandshakeRejectedClosed)
+			http.Error(w, ErrServerClosed.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		if p := transport.Protocol(r); p == 0 || (p == parser.ProtocolV3 && !cfg.AllowEIO3) {
+			m.Handshake(metrics.HandshakeRejectedProtocol)
+			http.Error(w, ProtocolError.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := cfg.AllowRequest(r); err != nil {
+			m.Handshake(metrics.HandshakeRejectedAllowRequest)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
 		n := atomic.AddInt32(&s.currentConnection, 1)
-		if int(n) > s.config.MaxConnection {
+		if int(n) > cfg.MaxConnection {
 			atomic.AddInt32(&s.currentConnection, -1)
+			m.Handshake(metrics.HandshakeRejectedMaxConnection)
 			http.Error(w, "too many connections", http.StatusServiceUnavailable)
 			return
 		}
 
-		sid = s.config.NewId(r)
+		sid = cfg.NewId(r)
 
-		var err error
-		conn, err = newServerConn(sid, w, r, s)
+		c, err := newConn(sid, r, s, cfg)
 		if err != nil {
+			s.release()
+			m.Handshake(metrics.HandshakeFailed)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		// reserve sid before handshaking, so a duplicated sid never replaces an existing session.
+		if !s.serverSessions.SetIfAbsent(sid, c) {
+			s.release()
+			m.Handshake(metrics.HandshakeFailed)
+			http.Error(w, "duplicated sid", http.StatusInternalServerError)
+			return
+		}
+		// track before the transport is created, which may hijack w, so w can still report Shutdown.
+		if !s.track(sid, c) {
+			s.serverSessions.Remove(sid)
+			s.release()
+			m.Handshake(metrics.HandshakeRejectedClosed)
+			http.Error(w, ErrServerClosed.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		// set cookie before the transport is created, which may be a websocket writing its upgrade response.
+		s.setCookie(w, cfg.Cookie, sid)
+		if err := c.open(w, r, cfg); err != nil {
+			w.Header().Del("Set-Cookie")
+			s.untrack(sid)
+			s.serverSessions.Remove(sid)
+			s.release()
+			m.Handshake(metrics.HandshakeFailed)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conn = c
+		m.SessionOpened(c.getCurrentName())
+
+		if s.isClosed() {
+			// Shutdown raced the handshake, and may have missed the connection before it's opened. It's closed by CLOSE packet through its transport.
+			m.Handshake(metrics.HandshakeRejectedClosed)
+			conn.Close()
+			conn.(*serverConn).ServeHTTP(w, r)
+			return
+		}
+		m.Handshake(metrics.HandshakeAccepted)
 
-		s.serverSessions.Set(sid, conn)
+		if f := cfg.Hooks.OnConnection; f != nil {
+			f(conn)
+		}
 
-		s.socketChan <- conn
+		select {
+		case s.socketChan <- conn:
+		case <-s.closeChan:
+			// not accepted, Shutdown closes it.
+		}
 	}
-	http.SetCookie(w, &http.Cookie{
-		Name:  s.config.Cookie,
-		Value: sid,
-	})
 
 	conn.(*serverConn).ServeHTTP(w, r)
 }
 
-// Accept returns Conn when client connect to server.
+func (s *Server) setCookie(w http.ResponseWriter, cookie CookieOptions, sid string) {
+	if c := cookie.cookie(sid); c != nil {
+		http.SetCookie(w, c)
+	}
+}
+
+// Accept returns Conn when client connect to server. It returns ErrServerClosed after Shutdown is called.
 func (s *Server) Accept() (Conn, error) {
-	return <-s.socketChan, nil
+	return s.AcceptContext(context.Background())
+}
+
+// AcceptContext is like Accept, but returns ctx.Err() if ctx is done before a client connects.
+func (s *Server) AcceptContext(ctx context.Context) (Conn, error) {
+	select {
+	case conn := <-s.socketChan:
+		return conn, nil
+	case <-s.closeChan:
+		return nil, ErrServerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Shutdown gracefully shuts down the server. It rejects new sessions with 503, sends CLOSE packet to all connections, and waits until they are closed or ctx is done. Requests of existing sessions are still served while draining.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.connsLocker.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closeChan)
+		s.brokerLocker.Lock()
+		if b := s.getBroker(); b != nil {
+			b.unsubscribe()
+		}
+		s.brokerLocker.Unlock()
+	}
+	conns := make([]Conn, 0, len(s.conns))
+	for _, conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.connsLocker.Unlock()
+
+	for _, conn := range conns {
+		if c, ok := conn.(*serverConn); ok {
+			c.setReason(ReasonServerShutdown)
+		}
+		conn.Close()
+	}
+
+	for s.Count() > 0 {
+		select {
+		case <-s.idleChan:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
 }
 
 func (s *Server) configure() config {
-	return s.config
+	return *s.config.Load().(*config)
 }
 
 func (s *Server) transports() transportCreaters {
@@ -174,7 +402,45 @@ func (s *Server) transports() transportCreaters {
 
 func (s *Server) onClose(id string) {
 	s.serverSessions.Remove(id)
-	atomic.AddInt32(&s.currentConnection, -1)
+	s.rooms.backend().LeaveAll(id)
+	s.connsLocker.Lock()
+	delete(s.conns, id)
+	s.connsLocker.Unlock()
+	s.release()
+}
+
+// release decreases the count of connections, and wakes up Shutdown if it's zero.
+func (s *Server) release() {
+	if atomic.AddInt32(&s.currentConnection, -1) == 0 {
+		select {
+		case s.idleChan <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// track adds conn to the connections which Shutdown closes. It returns false if server is closed.
+func (s *Server) track(id string, conn Conn) bool {
+	s.connsLocker.Lock()
+	defer s.connsLocker.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[id] = conn
+	return true
+}
+
+// untrack removes the connection of id which is tracked but fails to open.
+func (s *Server) untrack(id string) {
+	s.connsLocker.Lock()
+	defer s.connsLocker.Unlock()
+	delete(s.conns, id)
+}
+
+func (s *Server) isClosed() bool {
+	s.connsLocker.Lock()
+	defer s.connsLocker.Unlock()
+	return s.closed
 }
 
 func newId(r *http.Request) string {
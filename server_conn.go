@@ -1,6 +1,7 @@
 package engineio
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/metrics"
 	"github.com/teltechsystems/go-engine.io/parser"
 	"github.com/teltechsystems/go-engine.io/transport"
 )
@@ -40,10 +42,72 @@ type Conn interface {
 	NextWriter(messageType MessageType) (io.WriteCloser, error)
 }
 
-type transportCreaters map[string]transport.Creater
+// ContextConn is the Conn whose reading and writing can be canceled by context. Connections of server, Dial and DialReconnect implement it.
+type ContextConn interface {
+	Conn
 
-func (c transportCreaters) Get(name string) transport.Creater {
-	return c[name]
+	// NextReaderContext is like NextReader, but returns ctx.Err() if ctx is done before a message is received.
+	NextReaderContext(ctx context.Context) (MessageType, io.ReadCloser, error)
+
+	// NextWriterContext is like NextWriter, but returns ctx.Err() if ctx is done before the writer is available, such as while upgrading.
+	NextWriterContext(ctx context.Context, messageType MessageType) (io.WriteCloser, error)
+}
+
+// CloseReasonConn is the Conn which reports why it's closed. Connections of server, Dial and DialReconnect implement it.
+type CloseReasonConn interface {
+	Conn
+
+	// Err returns *CloseError after connection is closed, or nil if it's still open.
+	Err() error
+
+	// CloseReason returns why connection is closed. It's only meaningful after connection is closed.
+	CloseReason() DisconnectReason
+}
+
+// connErr returns Err of conn if it's CloseReasonConn, or nil otherwise.
+func connErr(conn Conn) error {
+	if c, ok := conn.(CloseReasonConn); ok {
+		return c.Err()
+	}
+	return nil
+}
+
+// closeReason returns CloseReason of conn if it's CloseReasonConn, or ReasonTransportClose otherwise.
+func closeReason(conn Conn) DisconnectReason {
+	if c, ok := conn.(CloseReasonConn); ok {
+		return c.CloseReason()
+	}
+	return ReasonTransportClose
+}
+
+// StatsConn is the Conn which counts its statistics. Connections of server, Dial and DialReconnect implement it.
+type StatsConn interface {
+	Conn
+
+	// Stats returns the snapshot of connection statistics. It's safe to call concurrently.
+	Stats() Stats
+}
+
+// nextReaderContext calls NextReaderContext of conn if it's ContextConn. Otherwise ctx is only checked before NextReader.
+func nextReaderContext(ctx context.Context, conn Conn) (MessageType, io.ReadCloser, error) {
+	if c, ok := conn.(ContextConn); ok {
+		return c.NextReaderContext(ctx)
+	}
+	if err := ctx.Err(); err != nil {
+		return MessageBinary, nil, err
+	}
+	return conn.NextReader()
+}
+
+// nextWriterContext calls NextWriterContext of conn if it's ContextConn. Otherwise ctx is only checked before NextWriter.
+func nextWriterContext(ctx context.Context, conn Conn, t MessageType) (io.WriteCloser, error) {
+	if c, ok := conn.(ContextConn); ok {
+		return c.NextWriterContext(ctx, t)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return conn.NextWriter(t)
 }
 
 type serverCallback interface {
@@ -62,9 +126,24 @@ const (
 	stateClosed
 )
 
+func (s state) String() string {
+	switch s {
+	case stateNormal:
+		return "normal"
+	case stateUpgrading:
+		return "upgrading"
+	case stateClosing:
+		return "closing"
+	case stateClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
 type serverConn struct {
 	id              string
 	request         *http.Request
+	createdAt       time.Time
 	callback        serverCallback
 	writerLocker    sync.Mutex
 	transportLocker sync.RWMutex
@@ -72,45 +151,85 @@ type serverConn struct {
 	current         transport.Server
 	upgradingName   string
 	upgrading       transport.Server
+	upgradeDone     chan struct{}
 	state           state
 	stateLocker     sync.RWMutex
 	readerChan      chan *connReader
 	pingTimeout     time.Duration
 	pingInterval    time.Duration
+	pingGeneration  uint64
 	pingChan        chan bool
+	closeChan       chan struct{}
 	closed          bool
+	protocol        int
+	reason          DisconnectReason
+	reasonSet       bool
+	err             error
+	stats           connStats
 }
 
 var InvalidError = errors.New("invalid transport")
 
+var ProtocolError = errors.New("unsupported protocol version")
+
 func newServerConn(id string, w http.ResponseWriter, r *http.Request, callback serverCallback) (*serverConn, error) {
-	transportName := r.URL.Query().Get("transport")
-	creater := callback.transports().Get(transportName)
+	cfg := callback.configure()
+	ret, err := newConn(id, r, callback, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := ret.open(w, r, cfg); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// newConn returns the connection which isn't opened yet, so its id can be reserved before handshaking. cfg is the config of handshake, which open must be called with too.
+func newConn(id string, r *http.Request, callback serverCallback, cfg config) (*serverConn, error) {
+	creater := callback.transports().Get(r.URL.Query().Get("transport"))
 	if creater.Name == "" {
 		return nil, InvalidError
 	}
-	ret := &serverConn{
-		id:           id,
-		request:      r,
-		callback:     callback,
-		state:        stateNormal,
-		readerChan:   make(chan *connReader),
-		pingTimeout:  callback.configure().PingTimeout,
-		pingInterval: callback.configure().PingInterval,
-		pingChan:     make(chan bool),
-	}
-	transport, err := creater.Server(w, r, ret)
+	protocol := transport.Protocol(r)
+	if protocol == 0 {
+		return nil, ProtocolError
+	}
+	return &serverConn{
+		id:             id,
+		request:        r,
+		createdAt:      time.Now(),
+		callback:       callback,
+		state:          stateUnknow,
+		readerChan:     make(chan *connReader),
+		pingTimeout:    cfg.PingTimeout,
+		pingInterval:   cfg.PingInterval,
+		pingGeneration: cfg.pingGeneration,
+		pingChan:       make(chan bool),
+		closeChan:      make(chan struct{}),
+		protocol:       protocol,
+	}, nil
+}
+
+// open creates the transport of handshake request r, and sends OPEN packet with cfg.
+func (c *serverConn) open(w http.ResponseWriter, r *http.Request, cfg config) error {
+	creater := c.callback.transports().Get(r.URL.Query().Get("transport"))
+	transport, err := creater.Server(w, r, c)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	ret.setCurrent(transportName, transport)
-	if err := ret.onOpen(); err != nil {
-		return nil, err
+	c.setCurrent(creater.Name, transport)
+	// the connection is visible in sessions already, lock writer before it's writable, so OPEN packet is sent first.
+	c.writerLocker.Lock()
+	c.setState(stateNormal)
+	err = c.onOpen(cfg)
+	c.writerLocker.Unlock()
+	if err != nil {
+		return err
 	}
 
-	go ret.pingLoop()
+	go c.pingLoop()
 
-	return ret, nil
+	return nil
 }
 
 func (c *serverConn) Id() string {
@@ -121,32 +240,58 @@ func (c *serverConn) Request() *http.Request {
 	return c.request
 }
 
+func (c *serverConn) Err() error {
+	c.stateLocker.RLock()
+	defer c.stateLocker.RUnlock()
+	if c.state != stateClosed {
+		return nil
+	}
+	return &CloseError{
+		Reason: c.reason,
+		Err:    c.err,
+	}
+}
+
+func (c *serverConn) CloseReason() DisconnectReason {
+	return c.getReason()
+}
+
+func (c *serverConn) Stats() Stats {
+	return c.stats.snapshot(c.getCurrentName())
+}
+
 func (c *serverConn) NextReader() (MessageType, io.ReadCloser, error) {
+	return c.NextReaderContext(context.Background())
+}
+
+func (c *serverConn) NextReaderContext(ctx context.Context) (MessageType, io.ReadCloser, error) {
 	if c.getState() == stateClosed {
 		return MessageBinary, nil, io.EOF
 	}
-	ret := <-c.readerChan
-	if ret == nil {
+	select {
+	case ret := <-c.readerChan:
+		return MessageType(ret.MessageType()), ret, nil
+	case <-c.closeChan:
 		return MessageBinary, nil, io.EOF
+	case <-ctx.Done():
+		return MessageBinary, nil, ctx.Err()
 	}
-	return MessageType(ret.MessageType()), ret, nil
 }
 
+// NextWriter waits for upgrading at most 1.5s, then returns error.
 func (c *serverConn) NextWriter(t MessageType) (io.WriteCloser, error) {
-	switch c.getState() {
-	case stateUpgrading:
-		for i := 0; i < 30; i++ {
-			time.Sleep(50 * time.Millisecond)
-			if c.getState() != stateUpgrading {
-				break
-			}
-		}
-		if c.getState() == stateUpgrading {
-			return nil, fmt.Errorf("upgrading")
-		}
-	case stateNormal:
-	default:
-		return nil, io.EOF
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	ret, err := c.NextWriterContext(ctx, t)
+	if err == context.DeadlineExceeded {
+		return nil, fmt.Errorf("upgrading")
+	}
+	return ret, err
+}
+
+func (c *serverConn) NextWriterContext(ctx context.Context, t MessageType) (io.WriteCloser, error) {
+	if err := c.waitWritable(ctx); err != nil {
+		return nil, err
 	}
 	c.writerLocker.Lock()
 	ret, err := c.getCurrent().NextWriter(message.MessageType(t), parser.MESSAGE)
@@ -154,57 +299,124 @@ func (c *serverConn) NextWriter(t MessageType) (io.WriteCloser, error) {
 		c.writerLocker.Unlock()
 		return ret, err
 	}
-	writer := newConnWriter(ret, &c.writerLocker)
+	writer := newConnWriter(c.stats.writer(ret, t, parser.MESSAGE), &c.writerLocker)
 	return writer, err
 }
 
+// waitWritable waits until connection isn't upgrading. It returns io.EOF if connection is closed.
+func (c *serverConn) waitWritable(ctx context.Context) error {
+	for {
+		switch c.getState() {
+		case stateUpgrading:
+			if err := c.waitUpgrade(ctx); err != nil {
+				return err
+			}
+			continue
+		case stateNormal:
+		default:
+			return io.EOF
+		}
+		break
+	}
+	return ctx.Err()
+}
+
+// writePrepared sends prepared packet p. If the transport is a PreparedWriter, p is sent without encoding again, and the deadline of ctx bounds the write.
+func (c *serverConn) writePrepared(ctx context.Context, p *parser.PreparedPacket) error {
+	if err := c.waitWritable(ctx); err != nil {
+		return err
+	}
+	c.writerLocker.Lock()
+	defer c.writerLocker.Unlock()
+
+	t := MessageType(p.MessageType())
+	current := c.getCurrent()
+	if w, ok := current.(transport.PreparedWriter); ok {
+		deadline, _ := ctx.Deadline()
+		if err := w.WritePrepared(p, deadline); err != nil {
+			return err
+		}
+		c.stats.onSend(t, p.Type(), int64(len(p.Data())))
+		return nil
+	}
+	w, err := current.NextWriter(p.MessageType(), p.Type())
+	if err != nil {
+		return err
+	}
+	w = c.stats.writer(w, t, p.Type())
+	if _, err := w.Write(p.Data()); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
 func (c *serverConn) Close() error {
 	if c.getState() != stateNormal && c.getState() != stateUpgrading {
 		return nil
 	}
+	c.setReason(ReasonServerClose)
 	if c.upgrading != nil {
 		c.upgrading.Close()
 	}
 	c.writerLocker.Lock()
 	if w, err := c.getCurrent().NextWriter(message.MessageText, parser.CLOSE); err == nil {
-		writer := newConnWriter(w, &c.writerLocker)
+		writer := newConnWriter(c.stats.writer(w, MessageText, parser.CLOSE), &c.writerLocker)
 		writer.Close()
 	} else {
 		c.writerLocker.Unlock()
 	}
-	if err := c.getCurrent().Close(); err != nil {
-		return err
-	}
+	// set state before closing transport, which may call OnClose at once.
 	c.setState(stateClosing)
-	return nil
+	return c.getCurrent().Close()
 }
 
 func (c *serverConn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if c.getState() == stateUnknow {
+		// id is reserved, but handshake isn't finished.
+		http.Error(w, "invalid sid", http.StatusBadRequest)
+		return
+	}
+	if max := c.callback.configure().MaxPayload; max > 0 && r.Method == "POST" {
+		if r.ContentLength > max {
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+	}
 	transportName := r.URL.Query().Get("transport")
-	if c.currentName != transportName {
+	if t := c.getUpgradeByName(transportName); t != nil {
+		t.ServeHTTP(w, r)
+		return
+	}
+	if c.getCurrentName() != transportName {
 		creater := c.callback.transports().Get(transportName)
-		if creater.Name == "" {
+		if creater.Name == "" || !creater.Upgrading {
 			http.Error(w, fmt.Sprintf("invalid transport %s", transportName), http.StatusBadRequest)
 			return
 		}
 		u, err := creater.Server(w, r, c)
 		if err != nil {
+			c.Metrics().Upgrade(c.getCurrentName(), creater.Name, false)
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 		c.setUpgrading(creater.Name, u)
+		u.ServeHTTP(w, r)
 		return
 	}
-	c.current.ServeHTTP(w, r)
+	c.getCurrent().ServeHTTP(w, r)
 }
 
 func (c *serverConn) OnPacket(r *parser.PacketDecoder) {
 	if s := c.getState(); s != stateNormal && s != stateUpgrading {
 		return
 	}
+	c.stats.onReceive(r)
 	switch r.Type() {
 	case parser.OPEN:
 	case parser.CLOSE:
+		c.setReason(ReasonClientClose)
 		c.getCurrent().Close()
 	case parser.PING:
 		c.writerLocker.Lock()
@@ -213,23 +425,33 @@ func (c *serverConn) OnPacket(r *parser.PacketDecoder) {
 		newWriter := t.NextWriter
 		if u != nil {
 			if w, _ := t.NextWriter(message.MessageText, parser.NOOP); w != nil {
-				w.Close()
+				c.stats.writer(w, MessageText, parser.NOOP).Close()
 			}
 			newWriter = u.NextWriter
 		}
 		if w, _ := newWriter(message.MessageText, parser.PONG); w != nil {
-			io.Copy(w, r)
+			w = c.stats.writer(w, MessageText, parser.PONG)
+			n, _ := io.Copy(w, r)
+			c.stats.addBytesIn(n)
 			w.Close()
 		}
 		c.writerLocker.Unlock()
 		fallthrough
 	case parser.PONG:
-		c.pingChan <- true
+		select {
+		case c.pingChan <- true:
+		case <-c.closeChan:
+		}
 	case parser.MESSAGE:
 		closeChan := make(chan struct{})
-		c.readerChan <- newConnReader(r, closeChan)
-		<-closeChan
-		close(closeChan)
+		reader := newConnReader(r, closeChan)
+		reader.stats = &c.stats
+		select {
+		case c.readerChan <- reader:
+			<-closeChan
+			close(closeChan)
+		case <-c.closeChan:
+		}
 		r.Close()
 	case parser.UPGRADE:
 		c.upgraded()
@@ -238,11 +460,15 @@ func (c *serverConn) OnPacket(r *parser.PacketDecoder) {
 }
 
 func (c *serverConn) OnClose(server transport.Server) {
-	if c.closed {
+	c.stateLocker.RLock()
+	closed := c.closed
+	c.stateLocker.RUnlock()
+	if closed {
 		return
 	}
 
 	if t := c.getUpgrade(); server == t {
+		c.Metrics().Upgrade(c.getCurrentName(), c.getUpgradeName(), false)
 		c.setUpgrading("", nil)
 		t.Close()
 		return
@@ -253,7 +479,17 @@ func (c *serverConn) OnClose(server transport.Server) {
 		return
 	}
 
+	c.stateLocker.Lock()
+	closed = c.closed
 	c.closed = true
+	c.stateLocker.Unlock()
+	if closed {
+		return
+	}
+	if c.getState() == stateUpgrading {
+		c.setReason(ReasonUpgradeError)
+		c.Metrics().Upgrade(c.getCurrentName(), c.getUpgradeName(), false)
+	}
 
 	t.Close()
 	if t := c.getUpgrade(); t != nil {
@@ -261,35 +497,75 @@ func (c *serverConn) OnClose(server transport.Server) {
 		c.setUpgrading("", nil)
 	}
 	c.setState(stateClosed)
-	close(c.readerChan)
-	close(c.pingChan)
+	// packets of other transports may be still coming, so channels are never closed.
+	close(c.closeChan)
+	c.Metrics().SessionClosed(c.getCurrentName())
 	c.callback.onClose(c.id)
+
+	if f := c.callback.configure().Hooks.OnDisconnect; f != nil {
+		f(c, c.getReason())
+	}
 }
 
-func (s *serverConn) onOpen() error {
+func (c *serverConn) OnError(server transport.Server, err error) {
+	c.transportLocker.RLock()
+	name, current := "", server == c.current
+	if current {
+		name = c.currentName
+	} else if server == c.upgrading {
+		name = c.upgradingName
+	}
+	c.transportLocker.RUnlock()
+	if name == "" {
+		return
+	}
+	if current {
+		c.setError(err)
+	}
+	if f := c.callback.configure().Hooks.OnTransportError; f != nil {
+		f(c, name, err)
+	}
+}
+
+// Metrics returns the metrics collector of server, which transports report to.
+func (c *serverConn) Metrics() metrics.Metrics {
+	if m := c.callback.configure().Metrics; m != nil {
+		return m
+	}
+	return metrics.Nop{}
+}
+
+func (s *serverConn) onOpen(cfg config) error {
 	upgrades := []string{}
-	for name := range s.callback.transports() {
-		if name == s.currentName {
-			continue
+	if cfg.AllowUpgrades {
+		for _, creater := range s.callback.transports() {
+			if creater.Name == s.getCurrentName() || !creater.Upgrading {
+				continue
+			}
+			upgrades = append(upgrades, creater.Name)
 		}
-		upgrades = append(upgrades, name)
 	}
 	type connectionInfo struct {
 		Sid          string        `json:"sid"`
 		Upgrades     []string      `json:"upgrades"`
 		PingInterval time.Duration `json:"pingInterval"`
 		PingTimeout  time.Duration `json:"pingTimeout"`
+		MaxPayload   int64         `json:"maxPayload,omitempty"`
 	}
 	resp := connectionInfo{
 		Sid:          s.Id(),
 		Upgrades:     upgrades,
-		PingInterval: s.callback.configure().PingInterval / time.Millisecond,
-		PingTimeout:  s.callback.configure().PingTimeout / time.Millisecond,
+		PingInterval: s.pingInterval / time.Millisecond,
+		PingTimeout:  s.pingTimeout / time.Millisecond,
+	}
+	if s.protocol == parser.ProtocolV4 {
+		resp.MaxPayload = cfg.MaxPayload
 	}
 	w, err := s.getCurrent().NextWriter(message.MessageText, parser.OPEN)
 	if err != nil {
 		return err
 	}
+	w = s.stats.writer(w, MessageText, parser.OPEN)
 	encoder := json.NewEncoder(w)
 	if err := encoder.Encode(resp); err != nil {
 		return err
@@ -307,6 +583,13 @@ func (c *serverConn) getCurrent() transport.Server {
 	return c.current
 }
 
+func (c *serverConn) getCurrentName() string {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+
+	return c.currentName
+}
+
 func (c *serverConn) getUpgrade() transport.Server {
 	c.transportLocker.RLock()
 	defer c.transportLocker.RUnlock()
@@ -314,6 +597,23 @@ func (c *serverConn) getUpgrade() transport.Server {
 	return c.upgrading
 }
 
+func (c *serverConn) getUpgradeName() string {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+
+	return c.upgradingName
+}
+
+func (c *serverConn) getUpgradeByName(name string) transport.Server {
+	c.transportLocker.RLock()
+	defer c.transportLocker.RUnlock()
+
+	if c.upgrading == nil || c.upgradingName != name {
+		return nil
+	}
+	return c.upgrading
+}
+
 func (c *serverConn) setCurrent(name string, s transport.Server) {
 	c.transportLocker.Lock()
 	defer c.transportLocker.Unlock()
@@ -328,13 +628,48 @@ func (c *serverConn) setUpgrading(name string, s transport.Server) {
 
 	c.upgradingName = name
 	c.upgrading = s
-	c.setState(stateUpgrading)
+	if s != nil {
+		c.setState(stateUpgrading)
+		if c.upgradeDone == nil {
+			c.upgradeDone = make(chan struct{})
+		}
+		return
+	}
+	if c.getState() == stateUpgrading {
+		c.setState(stateNormal)
+	}
+	c.endUpgrade()
+}
+
+// endUpgrade wakes up writers waiting for upgrading. It should be called with transportLocker held.
+func (c *serverConn) endUpgrade() {
+	if c.upgradeDone != nil {
+		close(c.upgradeDone)
+		c.upgradeDone = nil
+	}
+}
+
+// waitUpgrade waits until upgrading finishes, connection is closed or ctx is done.
+func (c *serverConn) waitUpgrade(ctx context.Context) error {
+	c.transportLocker.RLock()
+	done := c.upgradeDone
+	c.transportLocker.RUnlock()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+	case <-c.closeChan:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
 }
 
 func (c *serverConn) upgraded() {
 	c.transportLocker.Lock()
 
-	current := c.current
+	current, from, to := c.current, c.currentName, c.upgradingName
 	c.current = c.upgrading
 	c.currentName = c.upgradingName
 	c.upgrading = nil
@@ -343,7 +678,18 @@ func (c *serverConn) upgraded() {
 	c.transportLocker.Unlock()
 
 	current.Close()
+	c.stats.onUpgrade()
 	c.setState(stateNormal)
+
+	c.transportLocker.Lock()
+	c.endUpgrade()
+	c.transportLocker.Unlock()
+
+	c.Metrics().Upgrade(from, to, true)
+
+	if f := c.callback.configure().Hooks.OnUpgrade; f != nil {
+		f(c, from, to)
+	}
 }
 
 func (c *serverConn) getState() state {
@@ -358,32 +704,78 @@ func (c *serverConn) setState(state state) {
 	c.state = state
 }
 
+// setReason sets the reason of disconnection if it isn't set yet.
+func (c *serverConn) setReason(reason DisconnectReason) {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	if !c.reasonSet {
+		c.reason = reason
+		c.reasonSet = true
+	}
+}
+
+// setError sets the transport error which breaks connection, and the reason of disconnection if it isn't set yet.
+func (c *serverConn) setError(err error) {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	if !c.reasonSet {
+		c.reason = ReasonTransportError
+		c.reasonSet = true
+		c.err = err
+	}
+}
+
+// getReason returns the reason of disconnection, which is ReasonTransportClose if not set.
+func (c *serverConn) getReason() DisconnectReason {
+	c.stateLocker.RLock()
+	defer c.stateLocker.RUnlock()
+	return c.reason
+}
+
 func (c *serverConn) pingLoop() {
 	lastPing := time.Now()
 	lastTry := lastPing
 	for {
+		c.refreshPing()
+		pingTimeout := c.pingTimeout
+		if c.protocol == parser.ProtocolV4 {
+			// protocol v4 waits pong for timeout after sending ping every interval.
+			pingTimeout += c.pingInterval
+		}
 		now := time.Now()
 		pingDiff := now.Sub(lastPing)
 		tryDiff := now.Sub(lastTry)
 		select {
-		case ok := <-c.pingChan:
-			if !ok {
-				return
-			}
+		case <-c.closeChan:
+			return
+		case <-c.pingChan:
 			lastPing = time.Now()
 			lastTry = lastPing
 		case <-time.After(c.pingInterval - tryDiff):
 			c.writerLocker.Lock()
 			if w, _ := c.getCurrent().NextWriter(message.MessageText, parser.PING); w != nil {
-				writer := newConnWriter(w, &c.writerLocker)
+				writer := newConnWriter(c.stats.writer(w, MessageText, parser.PING), &c.writerLocker)
 				writer.Close()
 			} else {
 				c.writerLocker.Unlock()
 			}
 			lastTry = time.Now()
-		case <-time.After(c.pingTimeout - pingDiff):
+		case <-time.After(pingTimeout - pingDiff):
+			c.setReason(ReasonPingTimeout)
+			c.Metrics().PingTimeout()
 			c.Close()
 			return
 		}
 	}
 }
+
+// refreshPing adopts ping interval and timeout of server's config, if they are reconfigured for existing sessions. It's only called by pingLoop.
+func (c *serverConn) refreshPing() {
+	cfg := c.callback.configure()
+	if cfg.pingGeneration == c.pingGeneration {
+		return
+	}
+	c.pingInterval = cfg.PingInterval
+	c.pingTimeout = cfg.PingTimeout
+	c.pingGeneration = cfg.pingGeneration
+}
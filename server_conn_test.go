@@ -1,6 +1,7 @@
 package engineio
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -30,8 +31,8 @@ func newFakeServer() *FakeServer {
 			AllowUpgrades: true,
 		},
 		creaters: transportCreaters{
-			"polling":   polling.Creater,
-			"websocket": websocket.Creater,
+			polling.Creater,
+			websocket.Creater,
 		},
 		closed: make(map[string]int),
 	}
@@ -374,4 +375,64 @@ func TestConn(t *testing.T) {
 		})
 
 	})
+	Convey("Context", t, func() {
+		server := newFakeServer()
+		req, err := http.NewRequest("GET", "/?transport=polling", nil)
+		So(err, ShouldBeNil)
+		resp := httptest.NewRecorder()
+		conn, err := newServerConn("id", resp, req, server)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("reader canceled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second/20)
+			defer cancel()
+			_, _, err := conn.NextReaderContext(ctx)
+			So(err, ShouldResemble, context.DeadlineExceeded)
+		})
+
+		Convey("closed while upgrading", func() {
+			u, err := polling.NewServer(httptest.NewRecorder(), req, conn)
+			So(err, ShouldBeNil)
+			conn.setUpgrading("websocket", u)
+
+			conn.OnClose(conn.getCurrent())
+			So(conn.Err(), ShouldResemble, &CloseError{Reason: ReasonUpgradeError})
+		})
+
+		Convey("writer waits for upgrading", func() {
+			u, err := polling.NewServer(httptest.NewRecorder(), req, conn)
+			So(err, ShouldBeNil)
+			conn.setUpgrading("websocket", u)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second/20)
+			defer cancel()
+			_, err = conn.NextWriterContext(ctx, MessageText)
+			So(err, ShouldResemble, context.DeadlineExceeded)
+
+			go func() {
+				time.Sleep(time.Second / 20)
+				conn.setUpgrading("", nil)
+			}()
+			start := time.Now()
+			w, err := conn.NextWriterContext(context.Background(), MessageText)
+			So(err, ShouldBeNil)
+			So(w.Close(), ShouldBeNil)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+		})
+	})
+
+	Convey("Context of conn without ContextConn", t, func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := nextReaderContext(ctx, newSlowConn())
+		So(err, ShouldEqual, context.Canceled)
+		_, err = nextWriterContext(ctx, newSlowConn(), MessageText)
+		So(err, ShouldEqual, context.Canceled)
+	})
+
+	Convey("Close reason of conn without CloseReasonConn", t, func() {
+		So(connErr(newSlowConn()), ShouldBeNil)
+		So(closeReason(newSlowConn()), ShouldEqual, ReasonTransportClose)
+	})
 }
@@ -1,17 +1,25 @@
 package engineio
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/metrics"
 	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+	"github.com/teltechsystems/go-engine.io/websocket"
 )
 
 func TestServer(t *testing.T) {
@@ -19,16 +27,16 @@ func TestServer(t *testing.T) {
 		server, err := NewServer(nil)
 		So(err, ShouldBeNil)
 		server.SetPingInterval(time.Second)
-		So(server.config.PingInterval, ShouldEqual, time.Second)
+		So(server.configure().PingInterval, ShouldEqual, time.Second)
 		server.SetPingTimeout(10 * time.Second)
-		So(server.config.PingTimeout, ShouldEqual, 10*time.Second)
+		So(server.configure().PingTimeout, ShouldEqual, 10*time.Second)
 		f := func(*http.Request) error { return nil }
 		server.SetAllowRequest(f)
-		So(server.config.AllowRequest, ShouldEqual, f)
+		So(server.configure().AllowRequest, ShouldEqual, f)
 		server.SetAllowUpgrades(false)
-		So(server.config.AllowUpgrades, ShouldBeFalse)
+		So(server.configure().AllowUpgrades, ShouldBeFalse)
 		server.SetCookie("prefix")
-		So(server.config.Cookie, ShouldEqual, "prefix")
+		So(server.configure().Cookie.Name, ShouldEqual, "prefix")
 		So(server.GetMaxConnection(), ShouldEqual, 1000)
 	})
 
@@ -73,6 +81,200 @@ func TestServer(t *testing.T) {
 		So(res3.Code, ShouldEqual, 200)
 
 	})
+
+	Convey("Protocol negotiation", t, func() {
+		server, _ := NewServer(nil)
+
+		go func() {
+			for i := 0; i < 2; i++ {
+				server.Accept()
+			}
+		}()
+
+		Convey("v4 handshake", func() {
+			req := newOpenReq()
+			q := req.URL.Query()
+			q.Set("EIO", "4")
+			req.URL.RawQuery = q.Encode()
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+			So(res.Code, ShouldEqual, 200)
+			So(res.Header().Get("Content-Type"), ShouldEqual, "text/plain; charset=UTF-8")
+			So(res.Body.String(), ShouldStartWith, "0{")
+
+			packet, err := parser.NewV4PayloadDecoder(res.Body).Next()
+			So(err, ShouldBeNil)
+			So(packet.Type(), ShouldEqual, parser.OPEN)
+			openRes := map[string]interface{}{}
+			So(json.NewDecoder(packet).Decode(&openRes), ShouldBeNil)
+			So(openRes["maxPayload"], ShouldEqual, 1000000)
+		})
+
+		Convey("v3 handshake", func() {
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, newOpenReq())
+			So(res.Code, ShouldEqual, 200)
+			So(extractSid(res.Body), ShouldNotEqual, "")
+		})
+
+		Convey("v3 not allowed", func() {
+			server.SetAllowEIO3(false)
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, newOpenReq())
+			So(res.Code, ShouldEqual, 400)
+			So(strings.TrimSpace(res.Body.String()), ShouldEqual, ProtocolError.Error())
+		})
+
+		Convey("unknown version", func() {
+			req := newOpenReq()
+			q := req.URL.Query()
+			q.Set("EIO", "2")
+			req.URL.RawQuery = q.Encode()
+			res := httptest.NewRecorder()
+			server.ServeHTTP(res, req)
+			So(res.Code, ShouldEqual, 400)
+		})
+	})
+
+	Convey("Accept with context", t, func() {
+		server, _ := NewServer(nil)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second/20)
+		defer cancel()
+		_, err := server.AcceptContext(ctx)
+		So(err, ShouldResemble, context.DeadlineExceeded)
+	})
+
+	Convey("Shutdown", t, func() {
+		server, h := newEchoServer()
+		defer h.Close()
+
+		polling, err := Dial(h.URL, &DialOptions{DisableUpgrades: true})
+		So(err, ShouldBeNil)
+		websocket, err := Dial(h.URL, nil)
+		So(err, ShouldBeNil)
+		echo(websocket, MessageText, "hello")
+		So(server.Count(), ShouldEqual, 2)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		So(server.Shutdown(ctx), ShouldBeNil)
+		So(server.Count(), ShouldEqual, 0)
+
+		for _, conn := range []Conn{polling, websocket} {
+			_, _, err := conn.NextReader()
+			So(err, ShouldNotBeNil)
+		}
+
+		_, err = server.Accept()
+		So(err, ShouldEqual, ErrServerClosed)
+		_, err = server.AcceptContext(context.Background())
+		So(err, ShouldEqual, ErrServerClosed)
+
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, newOpenReq())
+		So(res.Code, ShouldEqual, http.StatusServiceUnavailable)
+
+		_, err = Dial(h.URL, nil)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Shutdown during handshake", t, func() {
+		for _, opts := range []*DialOptions{
+			{DisableUpgrades: true},
+			{Transports: []transport.Creater{websocket.Creater}},
+		} {
+			m := &shutdownMetrics{shutdown: make(chan error, 1)}
+			server, err := NewServerWithOptions(WithMetrics(m))
+			So(err, ShouldBeNil)
+			m.server = server
+			var writtenAfterHijack int32
+			h := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				server.ServeHTTP(&hijackWriter{ResponseWriter: w, writtenAfterHijack: &writtenAfterHijack}, r)
+			}))
+
+			conn, err := Dial(h.URL, opts)
+			if err == nil {
+				_, _, err = conn.NextReader()
+				So(err, ShouldNotBeNil)
+			}
+			So(<-m.shutdown, ShouldBeNil)
+			So(atomic.LoadInt32(&writtenAfterHijack), ShouldEqual, 0)
+			h.Close()
+		}
+	})
+
+	Convey("Shutdown with expired context", t, func() {
+		server, _ := NewServer(nil)
+		go server.Accept()
+
+		res := httptest.NewRecorder()
+		server.ServeHTTP(res, newOpenReq())
+		So(res.Code, ShouldEqual, 200)
+		sid := extractSid(res.Body)
+
+		// the message is never read, so the post and the connection keep open.
+		posted := make(chan bool)
+		go func() {
+			req, _ := http.NewRequest("POST", "/?transport=polling&sid="+sid, bytes.NewBufferString("6:4hello"))
+			posted <- true
+			server.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+		<-posted
+		time.Sleep(time.Second / 10)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second/10)
+		defer cancel()
+		So(server.Shutdown(ctx), ShouldResemble, context.DeadlineExceeded)
+	})
+
+	Convey("Metrics", t, func() {
+		server, h := newEchoServer()
+		defer h.Close()
+		events := newHookEvents(server)
+		m := metrics.NewPrometheus("", nil)
+		server.SetMetrics(m)
+		server.SetMaxConnection(1)
+		server.SetAllowRequest(func(r *http.Request) error {
+			if r.Header.Get("X-Reject") != "" {
+				return errors.New("rejected")
+			}
+			return nil
+		})
+
+		conn, err := Dial(h.URL, nil)
+		So(err, ShouldBeNil)
+		<-events.connections
+		So(<-events.upgrades, ShouldEqual, "polling->websocket")
+		So(writeMessage(conn, MessageText, []byte("hello")), ShouldBeNil)
+		_, r, err := conn.NextReader()
+		So(err, ShouldBeNil)
+		r.Close()
+
+		_, err = Dial(h.URL, &DialOptions{Header: http.Header{"X-Reject": {"1"}}})
+		So(err, ShouldNotBeNil)
+		_, err = Dial(h.URL, nil)
+		So(err, ShouldNotBeNil)
+
+		scrape := func() string {
+			resp := httptest.NewRecorder()
+			m.ServeHTTP(resp, httptest.NewRequest("GET", "/metrics", nil))
+			return resp.Body.String()
+		}
+		text := scrape()
+		So(text, ShouldContainSubstring, `engineio_sessions_active{transport="websocket"} 1`)
+		So(text, ShouldContainSubstring, `engineio_sessions_active{transport="polling"} 0`)
+		So(text, ShouldContainSubstring, `engineio_handshakes_total{result="accepted"} 1`)
+		So(text, ShouldContainSubstring, `engineio_handshakes_total{result="allow_request"} 1`)
+		So(text, ShouldContainSubstring, `engineio_handshakes_total{result="max_connection"} 1`)
+		So(text, ShouldContainSubstring, `engineio_upgrades_total{from="polling",to="websocket",result="success"} 1`)
+		So(text, ShouldContainSubstring, `engineio_polling_requests_total{method="GET",status="200"}`)
+		So(text, ShouldContainSubstring, `engineio_websocket_frames_total{direction="in"}`)
+		So(text, ShouldContainSubstring, `engineio_payload_size_bytes_count{transport="websocket",direction="out"}`)
+
+		conn.Close()
+		So(events.disconnect(), ShouldEqual, ReasonClientClose)
+		So(scrape(), ShouldContainSubstring, `engineio_sessions_active{transport="websocket"} 0`)
+	})
 }
 
 func newOpenReq() *http.Request {
@@ -90,3 +292,47 @@ func extractSid(body io.Reader) string {
 	json.NewDecoder(packet).Decode(&openRes)
 	return openRes["sid"].(string)
 }
+
+// shutdownMetrics shuts down server when a session is opened, which races the handshake.
+type shutdownMetrics struct {
+	metrics.Nop
+	server   *Server
+	shutdown chan error
+}
+
+func (m *shutdownMetrics) SessionOpened(transport string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		m.shutdown <- m.server.Shutdown(ctx)
+	}()
+	for !m.server.isClosed() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// hijackWriter records whether the response is written after the connection is hijacked.
+type hijackWriter struct {
+	http.ResponseWriter
+	hijacked           bool
+	writtenAfterHijack *int32
+}
+
+func (w *hijackWriter) WriteHeader(code int) {
+	if w.hijacked {
+		atomic.StoreInt32(w.writtenAfterHijack, 1)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *hijackWriter) Write(b []byte) (int, error) {
+	if w.hijacked {
+		atomic.StoreInt32(w.writtenAfterHijack, 1)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
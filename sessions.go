@@ -10,22 +10,127 @@ type Sessions interface {
 	Remove(id string)
 }
 
-type serverSessions struct {
+// RangeSessions is the Sessions which can enumerate and count its sessions. Server uses Sessions as RangeSessions, adapted by AdaptSessions. Its methods are called concurrently.
+type RangeSessions interface {
+	Sessions
+
+	// Range calls f for each session until f returns false. f may modify sessions.
+	Range(f func(id string, conn Conn) bool)
+
+	// Len returns the number of sessions.
+	Len() int
+
+	// SetIfAbsent sets conn as the session of id if id doesn't exist, and returns whether it's set.
+	SetIfAbsent(id string, conn Conn) bool
+}
+
+// AdaptSessions returns s as RangeSessions. If s doesn't implement RangeSessions, the returned RangeSessions tracks ids itself, so Range and Len only see the sessions which are set through it.
+func AdaptSessions(s Sessions) RangeSessions {
+	if ret, ok := s.(RangeSessions); ok {
+		return ret
+	}
+	return &sessionsAdapter{
+		Sessions: s,
+		ids:      make(map[string]struct{}),
+	}
+}
+
+type sessionsAdapter struct {
+	Sessions
+	locker sync.Mutex
+	ids    map[string]struct{}
+}
+
+func (s *sessionsAdapter) Set(id string, conn Conn) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.Sessions.Set(id, conn)
+	s.ids[id] = struct{}{}
+}
+
+func (s *sessionsAdapter) Remove(id string) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.Sessions.Remove(id)
+	delete(s.ids, id)
+}
+
+func (s *sessionsAdapter) SetIfAbsent(id string, conn Conn) bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if s.Sessions.Get(id) != nil {
+		return false
+	}
+	s.Sessions.Set(id, conn)
+	s.ids[id] = struct{}{}
+	return true
+}
+
+func (s *sessionsAdapter) Len() int {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return len(s.ids)
+}
+
+func (s *sessionsAdapter) Range(f func(id string, conn Conn) bool) {
+	s.locker.Lock()
+	ids := make([]string, 0, len(s.ids))
+	for id := range s.ids {
+		ids = append(ids, id)
+	}
+	s.locker.Unlock()
+
+	for _, id := range ids {
+		conn := s.Sessions.Get(id)
+		if conn == nil {
+			continue
+		}
+		if !f(id, conn) {
+			return
+		}
+	}
+}
+
+// sessionShards is the number of shards of serverSessions. Sessions are spread to shards by id, so lookups of different sessions rarely wait for the same lock.
+const sessionShards = 32
+
+type sessionShard struct {
 	sessions map[string]Conn
 	locker   sync.RWMutex
 }
 
+type serverSessions struct {
+	shards [sessionShards]sessionShard
+}
+
 func newServerSessions() *serverSessions {
-	return &serverSessions{
-		sessions: make(map[string]Conn),
+	ret := &serverSessions{}
+	for i := range ret.shards {
+		ret.shards[i].sessions = make(map[string]Conn)
+	}
+	return ret
+}
+
+// shard returns the shard of id by FNV-1a hash.
+func (s *serverSessions) shard(id string) *sessionShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
 	}
+	return &s.shards[h%sessionShards]
 }
 
 func (s *serverSessions) Get(id string) Conn {
-	s.locker.RLock()
-	defer s.locker.RUnlock()
+	shard := s.shard(id)
+	shard.locker.RLock()
+	defer shard.locker.RUnlock()
 
-	ret, ok := s.sessions[id]
+	ret, ok := shard.sessions[id]
 	if !ok {
 		return nil
 	}
@@ -33,15 +138,61 @@ func (s *serverSessions) Get(id string) Conn {
 }
 
 func (s *serverSessions) Set(id string, conn Conn) {
-	s.locker.Lock()
-	defer s.locker.Unlock()
+	shard := s.shard(id)
+	shard.locker.Lock()
+	defer shard.locker.Unlock()
 
-	s.sessions[id] = conn
+	shard.sessions[id] = conn
 }
 
 func (s *serverSessions) Remove(id string) {
-	s.locker.Lock()
-	defer s.locker.Unlock()
+	shard := s.shard(id)
+	shard.locker.Lock()
+	defer shard.locker.Unlock()
+
+	delete(shard.sessions, id)
+}
+
+func (s *serverSessions) SetIfAbsent(id string, conn Conn) bool {
+	shard := s.shard(id)
+	shard.locker.Lock()
+	defer shard.locker.Unlock()
 
-	delete(s.sessions, id)
+	if _, ok := shard.sessions[id]; ok {
+		return false
+	}
+	shard.sessions[id] = conn
+	return true
+}
+
+func (s *serverSessions) Len() int {
+	ret := 0
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.locker.RLock()
+		ret += len(shard.sessions)
+		shard.locker.RUnlock()
+	}
+	return ret
+}
+
+// Range iterates a copy of each shard, so f can modify sessions without deadlock.
+func (s *serverSessions) Range(f func(id string, conn Conn) bool) {
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.locker.RLock()
+		ids := make([]string, 0, len(shard.sessions))
+		conns := make([]Conn, 0, len(shard.sessions))
+		for id, conn := range shard.sessions {
+			ids = append(ids, id)
+			conns = append(conns, conn)
+		}
+		shard.locker.RUnlock()
+
+		for j, id := range ids {
+			if !f(id, conns[j]) {
+				return
+			}
+		}
+	}
 }
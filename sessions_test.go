@@ -1,25 +1,135 @@
 package engineio
 
 import (
-	. "github.com/smartystreets/goconvey/convey"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
 	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
 )
 
+type basicSessions struct {
+	sessions map[string]Conn
+	locker   sync.Mutex
+}
+
+func (s *basicSessions) Get(id string) Conn {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.sessions[id]
+}
+
+func (s *basicSessions) Set(id string, conn Conn) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.sessions[id] = conn
+}
+
+func (s *basicSessions) Remove(id string) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	delete(s.sessions, id)
+}
+
+func testSessions(sessions RangeSessions) {
+	So(sessions.Get("a"), ShouldBeNil)
+
+	sessions.Set("b", new(serverConn))
+	So(sessions.Get("b"), ShouldNotBeNil)
+
+	So(sessions.Get("a"), ShouldBeNil)
+
+	sessions.Set("c", new(serverConn))
+	So(sessions.Get("c"), ShouldNotBeNil)
+	So(sessions.Len(), ShouldEqual, 2)
+
+	sessions.Remove("b")
+	So(sessions.Get("b"), ShouldBeNil)
+	So(sessions.Len(), ShouldEqual, 1)
+
+	c := new(serverConn)
+	So(sessions.SetIfAbsent("c", c), ShouldBeFalse)
+	So(sessions.Get("c"), ShouldNotEqual, c)
+	So(sessions.SetIfAbsent("d", c), ShouldBeTrue)
+	So(sessions.Get("d"), ShouldEqual, c)
+
+	var ids []string
+	sessions.Range(func(id string, conn Conn) bool {
+		ids = append(ids, id)
+		sessions.Remove(id)
+		return true
+	})
+	sort.Strings(ids)
+	So(ids, ShouldResemble, []string{"c", "d"})
+	So(sessions.Len(), ShouldEqual, 0)
+}
+
 func TestServerSessions(t *testing.T) {
 	Convey("Server sessions", t, func() {
+		testSessions(newServerSessions())
+	})
+
+	Convey("Range stops when f returns false", t, func() {
+		sessions := newServerSessions()
+		for i := 0; i < 100; i++ {
+			sessions.Set(fmt.Sprint(i), new(serverConn))
+		}
+		So(sessions.Len(), ShouldEqual, 100)
+		n := 0
+		sessions.Range(func(id string, conn Conn) bool {
+			n++
+			return n < 10
+		})
+		So(n, ShouldEqual, 10)
+	})
+
+	Convey("Concurrent SetIfAbsent", t, func() {
 		sessions := newServerSessions()
+		wg := sync.WaitGroup{}
+		var locker sync.Mutex
+		set := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if sessions.SetIfAbsent("id", new(serverConn)) {
+					locker.Lock()
+					set++
+					locker.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		So(set, ShouldEqual, 1)
+	})
 
-		So(sessions.Get("a"), ShouldBeNil)
+	Convey("Adapt basic sessions", t, func() {
+		basic := &basicSessions{sessions: make(map[string]Conn)}
+		sessions := AdaptSessions(basic)
+		testSessions(sessions)
 
-		sessions.Set("b", new(serverConn))
-		So(sessions.Get("b"), ShouldNotBeNil)
+		native := newServerSessions()
+		So(AdaptSessions(native), ShouldEqual, native)
+	})
 
-		So(sessions.Get("a"), ShouldBeNil)
+	Convey("Duplicated sid", t, func() {
+		server, _ := NewServer(nil)
+		server.SetNewId(func(*http.Request) string { return "id" })
+		go server.Accept()
 
-		sessions.Set("c", new(serverConn))
-		So(sessions.Get("c"), ShouldNotBeNil)
+		res1 := httptest.NewRecorder()
+		server.ServeHTTP(res1, newOpenReq())
+		So(res1.Code, ShouldEqual, http.StatusOK)
+		So(server.Sessions().Len(), ShouldEqual, 1)
+		first := server.Sessions().Get("id")
 
-		sessions.Remove("b")
-		So(sessions.Get("b"), ShouldBeNil)
+		res2 := httptest.NewRecorder()
+		server.ServeHTTP(res2, newOpenReq())
+		So(res2.Code, ShouldEqual, http.StatusInternalServerError)
+		So(server.Sessions().Get("id"), ShouldEqual, first)
+		So(server.Count(), ShouldEqual, 1)
 	})
 }
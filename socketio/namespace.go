@@ -0,0 +1,86 @@
+package socketio
+
+import (
+	"sync"
+)
+
+// AckFunc sends the acknowledgement of an event with args. Only the first call sends, later calls return ErrAcked.
+type AckFunc func(args ...interface{}) error
+
+// EventHandler handles an event with args. ack is nil if the client doesn't want an acknowledgement.
+type EventHandler func(s *Socket, args []interface{}, ack AckFunc)
+
+// Namespace is a channel of sockets with its own handlers. Handlers should be set before serving.
+type Namespace struct {
+	name         string
+	locker       sync.RWMutex
+	onConnect    func(s *Socket, auth interface{}) error
+	onDisconnect func(s *Socket, reason string)
+	events       map[string]EventHandler
+}
+
+func newNamespace(name string) *Namespace {
+	return &Namespace{
+		name:   name,
+		events: make(map[string]EventHandler),
+	}
+}
+
+// Name returns the name of namespace, like "/chat".
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// OnConnect sets f to be called when a client connects to namespace, with the auth payload of the client, which is nil in protocol v4. If f returns an error, the client is refused with its message.
+//
+// f is called before the client knows it's connected. Events emitted in f are sent after the client is connected, so f must not wait for their acknowledgements.
+func (n *Namespace) OnConnect(f func(s *Socket, auth interface{}) error) {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	n.onConnect = f
+}
+
+// OnDisconnect sets f to be called when a socket of namespace is disconnected, after the handlers of its received events.
+func (n *Namespace) OnDisconnect(f func(s *Socket, reason string)) {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	n.onDisconnect = f
+}
+
+// OnEvent sets f to handle event. Events of a socket are handled in order, in a goroutine of the socket, so f can wait for acknowledgements.
+func (n *Namespace) OnEvent(event string, f EventHandler) {
+	n.locker.Lock()
+	defer n.locker.Unlock()
+
+	n.events[event] = f
+}
+
+func (n *Namespace) connect(s *Socket, auth interface{}) error {
+	n.locker.RLock()
+	f := n.onConnect
+	n.locker.RUnlock()
+
+	if f == nil {
+		return nil
+	}
+	return f(s, auth)
+}
+
+func (n *Namespace) disconnect(s *Socket, reason string) {
+	n.locker.RLock()
+	f := n.onDisconnect
+	n.locker.RUnlock()
+
+	if f != nil {
+		f(s, reason)
+	}
+}
+
+func (n *Namespace) handler(event string) EventHandler {
+	n.locker.RLock()
+	defer n.locker.RUnlock()
+
+	return n.events[event]
+}
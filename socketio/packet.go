@@ -0,0 +1,279 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	engineio "github.com/teltechsystems/go-engine.io"
+)
+
+// PacketType is the type of socket.io packet.
+type PacketType int
+
+const (
+	CONNECT PacketType = iota
+	DISCONNECT
+	EVENT
+	ACK
+	// CONNECT_ERROR is named ERROR in protocol v4.
+	CONNECT_ERROR
+	BINARY_EVENT
+	BINARY_ACK
+)
+
+func (t PacketType) String() string {
+	switch t {
+	case CONNECT:
+		return "connect"
+	case DISCONNECT:
+		return "disconnect"
+	case EVENT:
+		return "event"
+	case ACK:
+		return "ack"
+	case CONNECT_ERROR:
+		return "connect_error"
+	case BINARY_EVENT:
+		return "binary_event"
+	case BINARY_ACK:
+		return "binary_ack"
+	}
+	return "unknown"
+}
+
+// NoId is the id of packets which don't want an acknowledgement.
+const NoId int64 = -1
+
+// ErrInvalidPacket is returned by ReadPacket when the message isn't a socket.io packet.
+var ErrInvalidPacket = errors.New("socket.io: invalid packet")
+
+// Packet is a socket.io packet.
+//
+// Data is any value which can be marshaled to JSON. []byte in Data, directly or in []interface{} and map[string]interface{}, is sent as binary attachment, and WritePacket sends EVENT and ACK with attachments as BINARY_EVENT and BINARY_ACK. ReadPacket returns them as EVENT and ACK, with attachments put back in Data as []byte.
+type Packet struct {
+	Type      PacketType
+	Namespace string
+	Id        int64
+	Data      interface{}
+}
+
+// WritePacket writes p to conn, as a text message and a binary message for each attachment. Packets with attachments must not be written to conn concurrently, or their messages may interleave.
+func WritePacket(conn engineio.Conn, p *Packet) error {
+	var attachments [][]byte
+	data := deconstruct(p.Data, &attachments)
+
+	buf := bytes.NewBuffer(nil)
+	t := p.Type
+	if len(attachments) > 0 {
+		switch t {
+		case EVENT:
+			t = BINARY_EVENT
+		case ACK:
+			t = BINARY_ACK
+		}
+	}
+	buf.WriteString(strconv.Itoa(int(t)))
+	if t == BINARY_EVENT || t == BINARY_ACK {
+		buf.WriteString(strconv.Itoa(len(attachments)))
+		buf.WriteByte('-')
+	}
+	if p.Namespace != "" && p.Namespace != "/" {
+		buf.WriteString(p.Namespace)
+		buf.WriteByte(',')
+	}
+	if p.Id >= 0 {
+		buf.WriteString(strconv.FormatInt(p.Id, 10))
+	}
+	if data != nil {
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(data); err != nil {
+			return err
+		}
+		// Encoder appends a newline.
+		buf.Truncate(buf.Len() - 1)
+	}
+
+	if err := writeMessage(conn, engineio.MessageText, buf.Bytes()); err != nil {
+		return err
+	}
+	for _, a := range attachments {
+		if err := writeMessage(conn, engineio.MessageBinary, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPacket reads a packet from conn, with its attachments.
+func ReadPacket(conn engineio.Conn) (*Packet, error) {
+	t, b, err := readMessage(conn)
+	if err != nil {
+		return nil, err
+	}
+	if t != engineio.MessageText {
+		return nil, ErrInvalidPacket
+	}
+	p, n, err := decodeHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	// not preallocated, n is from client.
+	var attachments [][]byte
+	for i := 0; i < n; i++ {
+		t, b, err := readMessage(conn)
+		if err != nil {
+			return nil, err
+		}
+		if t != engineio.MessageBinary {
+			return nil, ErrInvalidPacket
+		}
+		attachments = append(attachments, b)
+	}
+	if p.Data, err = reconstruct(p.Data, attachments); err != nil {
+		return nil, err
+	}
+	switch p.Type {
+	case BINARY_EVENT:
+		p.Type = EVENT
+	case BINARY_ACK:
+		p.Type = ACK
+	}
+	return p, nil
+}
+
+// decodeHeader decodes the text message of a packet, and returns the number of its attachments.
+func decodeHeader(b []byte) (*Packet, int, error) {
+	if len(b) == 0 || b[0] < '0' || b[0] > '6' {
+		return nil, 0, ErrInvalidPacket
+	}
+	p := &Packet{
+		Type:      PacketType(b[0] - '0'),
+		Namespace: "/",
+		Id:        NoId,
+	}
+	i := 1
+	n := 0
+	if p.Type == BINARY_EVENT || p.Type == BINARY_ACK {
+		j := bytes.IndexByte(b[i:], '-')
+		if j < 0 {
+			return nil, 0, ErrInvalidPacket
+		}
+		var err error
+		if n, err = strconv.Atoi(string(b[i : i+j])); err != nil || n < 0 {
+			return nil, 0, ErrInvalidPacket
+		}
+		i += j + 1
+	}
+	if i < len(b) && b[i] == '/' {
+		j := bytes.IndexByte(b[i:], ',')
+		if j < 0 {
+			j = len(b) - i
+		}
+		p.Namespace = string(b[i : i+j])
+		i += j
+		if i < len(b) {
+			i++
+		}
+	}
+	j := i
+	for j < len(b) && b[j] >= '0' && b[j] <= '9' {
+		j++
+	}
+	if j > i {
+		id, err := strconv.ParseInt(string(b[i:j]), 10, 64)
+		if err != nil {
+			return nil, 0, ErrInvalidPacket
+		}
+		p.Id = id
+		i = j
+	}
+	if i < len(b) {
+		if err := json.Unmarshal(b[i:], &p.Data); err != nil {
+			return nil, 0, ErrInvalidPacket
+		}
+	}
+	return p, n, nil
+}
+
+// deconstruct returns v with []byte replaced by placeholders, and appends them to attachments.
+func deconstruct(v interface{}, attachments *[][]byte) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		ret := map[string]interface{}{
+			"_placeholder": true,
+			"num":          len(*attachments),
+		}
+		*attachments = append(*attachments, v)
+		return ret
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, e := range v {
+			ret[i] = deconstruct(e, attachments)
+		}
+		return ret
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			ret[k] = deconstruct(e, attachments)
+		}
+		return ret
+	}
+	return v
+}
+
+// reconstruct returns v with placeholders replaced by attachments.
+func reconstruct(v interface{}, attachments [][]byte) (interface{}, error) {
+	switch v := v.(type) {
+	case []interface{}:
+		for i, e := range v {
+			var err error
+			if v[i], err = reconstruct(e, attachments); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		if placeholder, _ := v["_placeholder"].(bool); placeholder {
+			num, ok := v["num"].(float64)
+			if !ok || num < 0 || int(num) >= len(attachments) {
+				return nil, fmt.Errorf("socket.io: invalid attachment %v", v["num"])
+			}
+			return attachments[int(num)], nil
+		}
+		for k, e := range v {
+			var err error
+			if v[k], err = reconstruct(e, attachments); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+func writeMessage(conn engineio.Conn, t engineio.MessageType, b []byte) error {
+	w, err := conn.NextWriter(t)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func readMessage(conn engineio.Conn) (engineio.MessageType, []byte, error) {
+	t, r, err := conn.NextReader()
+	if err != nil {
+		return t, nil, err
+	}
+	b, err := ioutil.ReadAll(r)
+	if cerr := r.Close(); err == nil {
+		err = cerr
+	}
+	return t, b, err
+}
@@ -0,0 +1,76 @@
+package socketio
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+	engineio "github.com/teltechsystems/go-engine.io"
+	"github.com/teltechsystems/go-engine.io/engineiotest"
+)
+
+func TestPacket(t *testing.T) {
+	Convey("Decode header", t, func() {
+		tests := []struct {
+			text        string
+			packet      Packet
+			attachments int
+		}{
+			{`0`, Packet{CONNECT, "/", NoId, nil}, 0},
+			{`0/chat,{"token":"abc"}`, Packet{CONNECT, "/chat", NoId, map[string]interface{}{"token": "abc"}}, 0},
+			{`1/chat`, Packet{DISCONNECT, "/chat", NoId, nil}, 0},
+			{`2["hello",1]`, Packet{EVENT, "/", NoId, []interface{}{"hello", float64(1)}}, 0},
+			{`2/chat,12["hello"]`, Packet{EVENT, "/chat", 12, []interface{}{"hello"}}, 0},
+			{`3/chat,12[]`, Packet{ACK, "/chat", 12, []interface{}{}}, 0},
+			{`4{"message":"denied"}`, Packet{CONNECT_ERROR, "/", NoId, map[string]interface{}{"message": "denied"}}, 0},
+			{`52-["up",{"_placeholder":true,"num":0}]`, Packet{BINARY_EVENT, "/", NoId, []interface{}{"up", map[string]interface{}{"_placeholder": true, "num": float64(0)}}}, 2},
+			{`61-/chat,3[{"_placeholder":true,"num":0}]`, Packet{BINARY_ACK, "/chat", 3, []interface{}{map[string]interface{}{"_placeholder": true, "num": float64(0)}}}, 1},
+		}
+		for _, test := range tests {
+			p, n, err := decodeHeader([]byte(test.text))
+			So(err, ShouldBeNil)
+			So(*p, ShouldResemble, test.packet)
+			So(n, ShouldEqual, test.attachments)
+		}
+	})
+
+	Convey("Invalid header", t, func() {
+		for _, text := range []string{``, `7`, `x`, `5["a"]`, `2["a"`} {
+			_, _, err := decodeHeader([]byte(text))
+			So(err, ShouldEqual, ErrInvalidPacket)
+		}
+	})
+
+	Convey("Write and read", t, func() {
+		server, client, shutdown, err := engineiotest.NewPair()
+		So(err, ShouldBeNil)
+		defer shutdown()
+
+		Convey("Text", func() {
+			p := &Packet{EVENT, "/chat", 3, []interface{}{"hello", "<b>"}}
+			So(WritePacket(client, p), ShouldBeNil)
+
+			t, b, err := readMessage(server)
+			So(err, ShouldBeNil)
+			So(t, ShouldEqual, engineio.MessageText)
+			So(string(b), ShouldEqual, `2/chat,3["hello","<b>"]`)
+		})
+
+		Convey("Attachments", func() {
+			p := &Packet{EVENT, "/", NoId, []interface{}{"up", []byte{1, 2}, map[string]interface{}{"b": []byte{3}}}}
+			So(WritePacket(client, p), ShouldBeNil)
+
+			got, err := ReadPacket(server)
+			So(err, ShouldBeNil)
+			So(got.Type, ShouldEqual, EVENT)
+			So(got.Data, ShouldResemble, []interface{}{"up", []byte{1, 2}, map[string]interface{}{"b": []byte{3}}})
+		})
+
+		Convey("Missing attachment", func() {
+			So(writeMessage(client, engineio.MessageText, []byte(`51-["up",{"_placeholder":true,"num":0}]`)), ShouldBeNil)
+			So(writeMessage(client, engineio.MessageText, []byte(`2["next"]`)), ShouldBeNil)
+
+			_, err := ReadPacket(server)
+			So(err, ShouldEqual, ErrInvalidPacket)
+		})
+	})
+}
@@ -0,0 +1,246 @@
+// Package socketio is the socket.io protocol on engine.io connections.
+//
+// It supports socket.io protocol v4 on engine.io v3 clients and v5 on engine.io v4 clients, with namespaces, events, acknowledgements and binary attachments. Packets are sent and received as messages of engineio.Conn.
+package socketio
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	engineio "github.com/teltechsystems/go-engine.io"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+const (
+	// ProtocolV4 is socket.io protocol v4, of socket.io 2.x on engine.io v3.
+	ProtocolV4 = 4
+	// ProtocolV5 is socket.io protocol v5, of socket.io 3.x and 4.x on engine.io v4.
+	ProtocolV5 = 5
+)
+
+// ErrDisconnected is returned when the socket is disconnected.
+var ErrDisconnected = errors.New("socket.io: socket disconnected")
+
+// Server serves socket.io on the connections of an engine.io server.
+type Server struct {
+	engine     *engineio.Server
+	locker     sync.RWMutex
+	namespaces map[string]*Namespace
+}
+
+// NewServer returns the socket.io server of engine, with the namespace "/".
+func NewServer(engine *engineio.Server) *Server {
+	ret := &Server{
+		engine:     engine,
+		namespaces: make(map[string]*Namespace),
+	}
+	ret.Of("/")
+	return ret
+}
+
+// Of returns the namespace of name, and creates it if it doesn't exist. Clients can only connect to the namespaces which are created.
+func (s *Server) Of(name string) *Namespace {
+	if name == "" {
+		name = "/"
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	ret, ok := s.namespaces[name]
+	if !ok {
+		ret = newNamespace(name)
+		s.namespaces[name] = ret
+	}
+	return ret
+}
+
+// Serve accepts connections of the engine.io server and serves them, until the engine.io server is shut down. It returns the error of Accept, like engineio.ErrServerClosed.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.engine.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves socket.io on conn until it's closed. It's called by Serve, or to serve connections accepted otherwise.
+func (s *Server) ServeConn(conn engineio.Conn) {
+	c := &client{
+		server:   s,
+		conn:     conn,
+		protocol: ProtocolV5,
+		sockets:  make(map[string]*Socket),
+	}
+	if r := conn.Request(); r != nil && transport.Protocol(r) == parser.ProtocolV3 {
+		c.protocol = ProtocolV4
+	}
+	defer c.close()
+
+	if c.protocol == ProtocolV4 {
+		// clients of v4 are connected to "/" implicitly.
+		c.connect("/", nil)
+	}
+	for {
+		p, err := ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		c.onPacket(p)
+	}
+}
+
+func (s *Server) namespace(name string) *Namespace {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	return s.namespaces[name]
+}
+
+// client is an engine.io connection, which has a socket for each connected namespace.
+type client struct {
+	server      *Server
+	conn        engineio.Conn
+	protocol    int
+	writeLocker sync.Mutex
+	locker      sync.Mutex
+	sockets     map[string]*Socket
+}
+
+// write writes p, so attachments of packets never interleave.
+func (c *client) write(p *Packet) error {
+	c.writeLocker.Lock()
+	defer c.writeLocker.Unlock()
+
+	return WritePacket(c.conn, p)
+}
+
+func (c *client) onPacket(p *Packet) {
+	switch p.Type {
+	case CONNECT:
+		name := p.Namespace
+		if c.protocol == ProtocolV4 {
+			// namespace of v4 may have a query, like "/chat?token=abc".
+			if i := strings.IndexByte(name, '?'); i >= 0 {
+				name = name[:i]
+			}
+		}
+		c.connect(name, p.Data)
+	case DISCONNECT:
+		if socket := c.remove(p.Namespace); socket != nil {
+			socket.onClose("client namespace disconnect")
+		}
+	case EVENT:
+		if socket := c.socket(p.Namespace); socket != nil {
+			socket.onEvent(p)
+		}
+	case ACK:
+		if socket := c.socket(p.Namespace); socket != nil {
+			socket.onAck(p)
+		}
+	}
+}
+
+func (c *client) connect(name string, auth interface{}) {
+	ns := c.server.namespace(name)
+	if ns == nil {
+		c.connectError(name, "Invalid namespace")
+		return
+	}
+
+	c.locker.Lock()
+	if _, ok := c.sockets[name]; ok {
+		c.locker.Unlock()
+		return
+	}
+	socket := newSocket(c.socketId(name), ns, c)
+	c.sockets[name] = socket
+	c.locker.Unlock()
+
+	if err := ns.connect(socket, auth); err != nil {
+		c.remove(name)
+		socket.onReject()
+		c.connectError(name, err.Error())
+		return
+	}
+	p := &Packet{
+		Type:      CONNECT,
+		Namespace: name,
+		Id:        NoId,
+	}
+	if c.protocol == ProtocolV5 {
+		p.Data = map[string]interface{}{"sid": socket.id}
+	}
+	if err := socket.onConnect(p); err != nil {
+		c.conn.Close()
+	}
+}
+
+func (c *client) connectError(name, message string) {
+	p := &Packet{
+		Type:      CONNECT_ERROR,
+		Namespace: name,
+		Id:        NoId,
+		Data:      message,
+	}
+	if c.protocol == ProtocolV5 {
+		p.Data = map[string]interface{}{"message": message}
+	}
+	c.write(p)
+}
+
+// socketId returns the id of socket in namespace name. Like socket.io, sockets of v4 are identified by the engine.io session, and sockets of v5 have random ids.
+func (c *client) socketId(name string) string {
+	if c.protocol == ProtocolV4 {
+		if name == "/" {
+			return c.conn.Id()
+		}
+		return name + "#" + c.conn.Id()
+	}
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return c.conn.Id() + name
+	}
+	return hex.EncodeToString(b)
+}
+
+func (c *client) socket(name string) *Socket {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return c.sockets[name]
+}
+
+func (c *client) remove(name string) *Socket {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	ret, ok := c.sockets[name]
+	if !ok {
+		return nil
+	}
+	delete(c.sockets, name)
+	return ret
+}
+
+func (c *client) close() {
+	c.conn.Close()
+	reason := engineio.ReasonTransportClose.String()
+	if conn, ok := c.conn.(engineio.CloseReasonConn); ok {
+		reason = conn.CloseReason().String()
+	}
+
+	c.locker.Lock()
+	sockets := c.sockets
+	c.sockets = make(map[string]*Socket)
+	c.locker.Unlock()
+
+	for _, socket := range sockets {
+		socket.onClose(reason)
+	}
+}
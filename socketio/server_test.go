@@ -0,0 +1,166 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	engineio "github.com/teltechsystems/go-engine.io"
+	"github.com/teltechsystems/go-engine.io/engineiotest"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+func newTestServer() (*engineio.Server, *Server) {
+	engine, _ := engineio.NewServerWithOptions(engineiotest.Option(), engineio.WithTransports(engineiotest.Name))
+	server := NewServer(engine)
+	go server.Serve()
+	return engine, server
+}
+
+func dial(engine *engineio.Server, protocol int) engineio.Conn {
+	conn, err := engineio.Dial("http://engineiotest/engine.io/", &engineio.DialOptions{
+		Transports:      []transport.Creater{engineiotest.Creater(engine)},
+		Protocol:        protocol,
+		DisableUpgrades: true,
+	})
+	So(err, ShouldBeNil)
+	return conn
+}
+
+func read(conn engineio.Conn) *Packet {
+	p, err := ReadPacket(conn)
+	So(err, ShouldBeNil)
+	return p
+}
+
+func TestServer(t *testing.T) {
+	Convey("Protocol v5", t, func() {
+		engine, server := newTestServer()
+		defer engine.Shutdown(context.Background())
+
+		auths := make(chan interface{}, 1)
+		disconnects := make(chan string, 1)
+		server.Of("/").OnConnect(func(s *Socket, auth interface{}) error {
+			auths <- auth
+			return s.Emit("welcome", s.Protocol())
+		})
+		server.Of("/").OnDisconnect(func(s *Socket, reason string) {
+			disconnects <- reason
+		})
+		acks := make(chan error, 2)
+		server.Of("/").OnEvent("echo", func(s *Socket, args []interface{}, ack AckFunc) {
+			acks <- ack(args...)
+			acks <- ack()
+		})
+		askErrs := make(chan error, 1)
+		server.Of("/").OnEvent("ask", func(s *Socket, args []interface{}, ack AckFunc) {
+			ret, err := s.EmitWithAck(context.Background(), "question", args...)
+			if err != nil {
+				askErrs <- err
+				return
+			}
+			s.Emit("answer", ret...)
+		})
+
+		conn := dial(engine, 4)
+		defer conn.Close()
+
+		So(WritePacket(conn, &Packet{CONNECT, "/", NoId, map[string]interface{}{"token": "abc"}}), ShouldBeNil)
+		So(<-auths, ShouldResemble, map[string]interface{}{"token": "abc"})
+		p := read(conn)
+		So(p.Type, ShouldEqual, CONNECT)
+		sid, _ := p.Data.(map[string]interface{})["sid"].(string)
+		So(sid, ShouldNotEqual, "")
+		So(read(conn).Data, ShouldResemble, []interface{}{"welcome", float64(ProtocolV5)})
+
+		Convey("Ack with attachments", func() {
+			So(WritePacket(conn, &Packet{EVENT, "/", 7, []interface{}{"echo", "text", []byte{1, 2, 3}}}), ShouldBeNil)
+			p := read(conn)
+			So(p.Type, ShouldEqual, ACK)
+			So(p.Id, ShouldEqual, 7)
+			So(p.Data, ShouldResemble, []interface{}{"text", []byte{1, 2, 3}})
+			So(<-acks, ShouldBeNil)
+			So(<-acks, ShouldEqual, ErrAcked)
+		})
+
+		Convey("Emit with ack", func() {
+			So(WritePacket(conn, &Packet{EVENT, "/", NoId, []interface{}{"ask", "name?"}}), ShouldBeNil)
+			p := read(conn)
+			So(p.Type, ShouldEqual, EVENT)
+			So(p.Id, ShouldNotEqual, NoId)
+			So(p.Data, ShouldResemble, []interface{}{"question", "name?"})
+
+			So(WritePacket(conn, &Packet{ACK, "/", p.Id, []interface{}{"gopher"}}), ShouldBeNil)
+			So(read(conn).Data, ShouldResemble, []interface{}{"answer", "gopher"})
+		})
+
+		Convey("Pending acks fail on disconnect", func() {
+			So(WritePacket(conn, &Packet{EVENT, "/", NoId, []interface{}{"ask", "name?"}}), ShouldBeNil)
+			read(conn)
+			So(WritePacket(conn, &Packet{DISCONNECT, "/", NoId, nil}), ShouldBeNil)
+			So(<-askErrs, ShouldEqual, ErrDisconnected)
+			So(<-disconnects, ShouldEqual, "client namespace disconnect")
+		})
+
+		Convey("Invalid namespace", func() {
+			So(WritePacket(conn, &Packet{CONNECT, "/unknown", NoId, nil}), ShouldBeNil)
+			p := read(conn)
+			So(p.Type, ShouldEqual, CONNECT_ERROR)
+			So(p.Namespace, ShouldEqual, "/unknown")
+			So(p.Data, ShouldResemble, map[string]interface{}{"message": "Invalid namespace"})
+		})
+	})
+
+	Convey("Protocol v4", t, func() {
+		engine, server := newTestServer()
+		defer engine.Shutdown(context.Background())
+
+		disconnects := make(chan string, 1)
+		server.Of("/").OnDisconnect(func(s *Socket, reason string) {
+			disconnects <- reason
+		})
+		server.Of("/admin").OnConnect(func(s *Socket, auth interface{}) error {
+			return errors.New("not authorized")
+		})
+		sockets := make(chan *Socket, 1)
+		server.Of("/chat").OnConnect(func(s *Socket, auth interface{}) error {
+			sockets <- s
+			return nil
+		})
+
+		conn := dial(engine, 3)
+		defer conn.Close()
+
+		p := read(conn)
+		So(p.Type, ShouldEqual, CONNECT)
+		So(p.Namespace, ShouldEqual, "/")
+		So(p.Data, ShouldBeNil)
+
+		So(WritePacket(conn, &Packet{CONNECT, "/chat?token=abc", NoId, nil}), ShouldBeNil)
+		s := <-sockets
+		So(s.Namespace(), ShouldEqual, "/chat")
+		So(s.Id(), ShouldEqual, "/chat#"+conn.Id())
+		So(read(conn).Namespace, ShouldEqual, "/chat")
+
+		So(WritePacket(conn, &Packet{CONNECT, "/admin", NoId, nil}), ShouldBeNil)
+		p = read(conn)
+		So(p.Type, ShouldEqual, CONNECT_ERROR)
+		So(p.Data, ShouldEqual, "not authorized")
+
+		So(s.Disconnect(), ShouldBeNil)
+		p = read(conn)
+		So(p.Type, ShouldEqual, DISCONNECT)
+		So(p.Namespace, ShouldEqual, "/chat")
+		So(s.Emit("late"), ShouldEqual, ErrDisconnected)
+
+		conn.Close()
+		select {
+		case reason := <-disconnects:
+			So(reason, ShouldEqual, engineio.ReasonClientClose.String())
+		case <-time.After(time.Second):
+			So("timeout", ShouldBeNil)
+		}
+	})
+}
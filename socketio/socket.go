@@ -0,0 +1,306 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	engineio "github.com/teltechsystems/go-engine.io"
+)
+
+// ErrAcked is returned by AckFunc when the acknowledgement is already sent.
+var ErrAcked = errors.New("socket.io: already acknowledged")
+
+// Socket is a client connected to a namespace. Its methods can be called concurrently.
+type Socket struct {
+	id        string
+	namespace *Namespace
+	client    *client
+	events    *queue
+
+	locker    sync.Mutex
+	connected bool
+	closed    bool
+	pending   []*Packet
+
+	ackLocker sync.Mutex
+	ackId     int64
+	acks      map[int64]chan []interface{}
+}
+
+func newSocket(id string, namespace *Namespace, client *client) *Socket {
+	return &Socket{
+		id:        id,
+		namespace: namespace,
+		client:    client,
+		events:    newQueue(),
+		acks:      make(map[int64]chan []interface{}),
+	}
+}
+
+// Id returns the id of socket.
+func (s *Socket) Id() string {
+	return s.id
+}
+
+// Namespace returns the name of namespace which socket is connected to.
+func (s *Socket) Namespace() string {
+	return s.namespace.name
+}
+
+// Conn returns the engine.io connection of socket, which is shared by sockets of the client in other namespaces.
+func (s *Socket) Conn() engineio.Conn {
+	return s.client.conn
+}
+
+// Protocol returns the socket.io protocol of client, ProtocolV4 or ProtocolV5.
+func (s *Socket) Protocol() int {
+	return s.client.protocol
+}
+
+// Emit sends event with args to client.
+func (s *Socket) Emit(event string, args ...interface{}) error {
+	return s.send(s.eventPacket(NoId, event, args))
+}
+
+// EmitWithAck sends event with args to client, and waits for its acknowledgement. It returns ctx.Err() if ctx is done before the acknowledgement is received, or ErrDisconnected if socket is disconnected.
+func (s *Socket) EmitWithAck(ctx context.Context, event string, args ...interface{}) ([]interface{}, error) {
+	ch := make(chan []interface{}, 1)
+	s.ackLocker.Lock()
+	if s.acks == nil {
+		s.ackLocker.Unlock()
+		return nil, ErrDisconnected
+	}
+	id := s.ackId
+	s.ackId++
+	s.acks[id] = ch
+	s.ackLocker.Unlock()
+
+	defer func() {
+		s.ackLocker.Lock()
+		if s.acks != nil {
+			delete(s.acks, id)
+		}
+		s.ackLocker.Unlock()
+	}()
+
+	if err := s.send(s.eventPacket(id, event, args)); err != nil {
+		return nil, err
+	}
+	select {
+	case ret, ok := <-ch:
+		if !ok {
+			return nil, ErrDisconnected
+		}
+		return ret, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Disconnect disconnects socket from namespace. The engine.io connection is kept for other namespaces.
+func (s *Socket) Disconnect() error {
+	if s.client.remove(s.namespace.name) != s {
+		return ErrDisconnected
+	}
+	err := s.client.write(&Packet{
+		Type:      DISCONNECT,
+		Namespace: s.namespace.name,
+		Id:        NoId,
+	})
+	s.onClose("server namespace disconnect")
+	return err
+}
+
+func (s *Socket) eventPacket(id int64, event string, args []interface{}) *Packet {
+	return &Packet{
+		Type:      EVENT,
+		Namespace: s.namespace.name,
+		Id:        id,
+		Data:      append([]interface{}{event}, args...),
+	}
+}
+
+// send writes p, or queues it until socket is connected.
+func (s *Socket) send(p *Packet) error {
+	s.locker.Lock()
+	if s.closed {
+		s.locker.Unlock()
+		return ErrDisconnected
+	}
+	if !s.connected {
+		s.pending = append(s.pending, p)
+		s.locker.Unlock()
+		return nil
+	}
+	s.locker.Unlock()
+	return s.client.write(p)
+}
+
+// onConnect writes the CONNECT packet p and the packets sent before it.
+func (s *Socket) onConnect(p *Packet) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	if err := s.client.write(p); err != nil {
+		return err
+	}
+	for _, p := range s.pending {
+		if err := s.client.write(p); err != nil {
+			return err
+		}
+	}
+	s.pending = nil
+	s.connected = true
+	return nil
+}
+
+func (s *Socket) onEvent(p *Packet) {
+	args, ok := p.Data.([]interface{})
+	if !ok || len(args) == 0 {
+		return
+	}
+	event, ok := args[0].(string)
+	if !ok {
+		return
+	}
+	handler := s.namespace.handler(event)
+	if handler == nil {
+		return
+	}
+	var ack AckFunc
+	if p.Id != NoId {
+		id := p.Id
+		var once sync.Once
+		ack = func(args ...interface{}) error {
+			err := ErrAcked
+			once.Do(func() {
+				err = s.send(&Packet{
+					Type:      ACK,
+					Namespace: s.namespace.name,
+					Id:        id,
+					Data:      append([]interface{}{}, args...),
+				})
+			})
+			return err
+		}
+	}
+	s.events.push(func() {
+		handler(s, args[1:], ack)
+	})
+}
+
+func (s *Socket) onAck(p *Packet) {
+	s.ackLocker.Lock()
+	ch, ok := s.acks[p.Id]
+	if ok {
+		delete(s.acks, p.Id)
+	}
+	s.ackLocker.Unlock()
+
+	if ok {
+		args, _ := p.Data.([]interface{})
+		ch <- args
+	}
+}
+
+// onReject closes socket which is refused by OnConnect.
+func (s *Socket) onReject() {
+	if s.markClosed() {
+		s.events.close(nil)
+	}
+}
+
+// onClose closes socket, and calls OnDisconnect after the handlers of received events.
+func (s *Socket) onClose(reason string) {
+	if s.markClosed() {
+		s.events.close(func() {
+			s.namespace.disconnect(s, reason)
+		})
+	}
+}
+
+// markClosed marks socket closed and fails waiting acknowledgements. It returns false if socket is already closed.
+func (s *Socket) markClosed() bool {
+	s.locker.Lock()
+	if s.closed {
+		s.locker.Unlock()
+		return false
+	}
+	s.closed = true
+	s.pending = nil
+	s.locker.Unlock()
+
+	s.ackLocker.Lock()
+	for _, ch := range s.acks {
+		close(ch)
+	}
+	s.acks = nil
+	s.ackLocker.Unlock()
+	return true
+}
+
+// queue runs functions in order in its own goroutine, so the read loop never waits for handlers.
+type queue struct {
+	locker sync.Mutex
+	funcs  []func()
+	closed bool
+	notify chan struct{}
+}
+
+func newQueue() *queue {
+	ret := &queue{
+		notify: make(chan struct{}, 1),
+	}
+	go ret.loop()
+	return ret
+}
+
+func (q *queue) push(f func()) {
+	q.locker.Lock()
+	if q.closed {
+		q.locker.Unlock()
+		return
+	}
+	q.funcs = append(q.funcs, f)
+	q.locker.Unlock()
+	q.signal()
+}
+
+// close queues last, if it's not nil, as the last function. The goroutine of queue exits after running it.
+func (q *queue) close(last func()) {
+	q.locker.Lock()
+	if last != nil {
+		q.funcs = append(q.funcs, last)
+	}
+	q.closed = true
+	q.locker.Unlock()
+	q.signal()
+}
+
+func (q *queue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) loop() {
+	for range q.notify {
+		q.locker.Lock()
+		funcs := q.funcs
+		q.funcs = nil
+		closed := q.closed
+		q.locker.Unlock()
+
+		for _, f := range funcs {
+			f()
+		}
+		if closed {
+			return
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+type client struct {
+	req            http.Request
+	resp           *http.Response
+	reader         *bufio.Reader
+	payloadEncoder *parser.PayloadEncoder
+	client         *http.Client
+	protocol       int
+	state          state
+	stateLocker    sync.Mutex
+	postLocker     sync.Mutex
+}
+
+func NewClient(r *http.Request) (transport.Client, error) {
+	protocol := transport.Protocol(r)
+	newEncoder := parser.NewStringPayloadEncoder
+	if protocol == parser.ProtocolV4 {
+		newEncoder = parser.NewV4PayloadEncoder
+	}
+	ret := &client{
+		req:            *r,
+		payloadEncoder: newEncoder(),
+		client:         http.DefaultClient,
+		protocol:       protocol,
+		state:          stateNormal,
+	}
+
+	req := ret.newReq("GET", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := ret.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("stream failed: %s", bytes.TrimSpace(b))
+	}
+	ret.resp = resp
+	ret.reader = bufio.NewReader(resp.Body)
+	return ret, nil
+}
+
+func (c *client) Response() *http.Response {
+	return c.resp
+}
+
+func (c *client) NextReader() (*parser.PacketDecoder, error) {
+	var data []byte
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if len(data) == 0 {
+				continue
+			}
+			return decodeEvent(c.protocol, data)
+		}
+		if bytes.HasPrefix(line, []byte("data:")) {
+			data = append(data, bytes.TrimPrefix(line[len("data:"):], []byte(" "))...)
+		}
+	}
+}
+
+func (c *client) NextWriter(messageType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	if c.getState() != stateNormal {
+		return nil, io.EOF
+	}
+	next := c.payloadEncoder.NextBinary
+	if messageType == message.MessageText {
+		next = c.payloadEncoder.NextString
+	}
+	w, err := next(packetType)
+	if err != nil {
+		return nil, err
+	}
+	return &clientWriter{
+		WriteCloser: w,
+		client:      c,
+	}, nil
+}
+
+func (c *client) Close() error {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	if c.state != stateNormal {
+		return nil
+	}
+	c.state = stateClosed
+	return c.resp.Body.Close()
+}
+
+func (c *client) newReq(method string, body io.Reader) *http.Request {
+	req := c.req
+	req.Method = method
+	req.Header = make(http.Header)
+	for k, v := range c.req.Header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Body = ioutil.NopCloser(body)
+	}
+	return &req
+}
+
+func (c *client) doPost() error {
+	if c.getState() != stateNormal {
+		return io.EOF
+	}
+	c.postLocker.Lock()
+	defer c.postLocker.Unlock()
+	buf := bytes.NewBuffer(nil)
+	if err := c.payloadEncoder.EncodeTo(buf); err != nil {
+		return err
+	}
+	resp, err := c.client.Do(c.newReq("POST", buf))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("post failed: %s", bytes.TrimSpace(b))
+	}
+	return nil
+}
+
+func (c *client) getState() state {
+	c.stateLocker.Lock()
+	defer c.stateLocker.Unlock()
+	return c.state
+}
+
+type clientWriter struct {
+	io.WriteCloser
+	client *client
+}
+
+func (w *clientWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return w.client.doPost()
+}
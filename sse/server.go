@@ -0,0 +1,255 @@
+package sse
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+// Server streams packets to client as text/event-stream on a long-lived GET request, and receives packets from POST requests as polling payload.
+type Server struct {
+	callback   transport.Callback
+	protocol   int
+	sendChan   chan bool
+	closeChan  chan struct{}
+	buffers    [][]byte
+	streaming  bool
+	active     int
+	state      state
+	locker     sync.Mutex
+	postLocker sync.Mutex
+}
+
+func NewServer(w http.ResponseWriter, r *http.Request, callback transport.Callback) (transport.Server, error) {
+	return &Server{
+		callback:  callback,
+		protocol:  transport.Protocol(r),
+		sendChan:  make(chan bool, 1),
+		closeChan: make(chan struct{}),
+		state:     stateNormal,
+	}, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.get(w, r)
+	case "POST":
+		s.post(w, r)
+	default:
+		http.Error(w, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+// Buffered returns the number of packets waiting to be streamed.
+func (s *Server) Buffered() int {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return len(s.buffers)
+}
+
+func (s *Server) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	if s.getState() != stateNormal {
+		return nil, io.EOF
+	}
+	newEncoder := parser.NewStringEncoder
+	if msgType == message.MessageBinary {
+		newEncoder = parser.NewB64Encoder
+		if s.protocol == parser.ProtocolV4 {
+			newEncoder = parser.NewV4B64Encoder
+		}
+	}
+	buf := bytes.NewBuffer(nil)
+	encoder, err := newEncoder(buf, packetType)
+	if err != nil {
+		return nil, err
+	}
+	return &writer{
+		PacketEncoder: encoder,
+		buf:           buf,
+		server:        s,
+	}, nil
+}
+
+func (s *Server) Close() error {
+	s.locker.Lock()
+	if s.state != stateNormal {
+		s.locker.Unlock()
+		return nil
+	}
+	s.state = stateClosing
+	close(s.closeChan)
+	s.locker.Unlock()
+
+	s.done()
+	return nil
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusBadRequest)
+		return
+	}
+	s.locker.Lock()
+	if s.streaming {
+		s.locker.Unlock()
+		http.Error(w, "overlay get", http.StatusBadRequest)
+		return
+	}
+	if s.state != stateNormal {
+		s.locker.Unlock()
+		http.Error(w, "closed", http.StatusBadRequest)
+		return
+	}
+	s.streaming = true
+	s.active++
+	s.locker.Unlock()
+
+	defer func() {
+		s.locker.Lock()
+		s.streaming = false
+		s.active--
+		s.locker.Unlock()
+		s.done()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		closing := false
+		select {
+		case <-s.sendChan:
+		case <-s.closeChan:
+			closing = true
+		case <-r.Context().Done():
+			s.Close()
+			return
+		}
+		if err := s.flush(w); err != nil {
+			transport.ReportError(s.callback, s, err)
+			s.Close()
+			return
+		}
+		flusher.Flush()
+		if closing {
+			return
+		}
+	}
+}
+
+func (s *Server) flush(w io.Writer) error {
+	s.locker.Lock()
+	buffers := s.buffers
+	s.buffers = nil
+	s.locker.Unlock()
+
+	for _, b := range buffers {
+		if _, err := w.Write(encodeEvent(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) post(w http.ResponseWriter, r *http.Request) {
+	s.locker.Lock()
+	if s.state != stateNormal {
+		s.locker.Unlock()
+		http.Error(w, "closed", http.StatusBadRequest)
+		return
+	}
+	s.active++
+	s.locker.Unlock()
+
+	defer func() {
+		s.locker.Lock()
+		s.active--
+		s.locker.Unlock()
+		s.done()
+	}()
+
+	s.postLocker.Lock()
+	defer s.postLocker.Unlock()
+
+	newDecoder := parser.NewPayloadDecoder
+	if s.protocol == parser.ProtocolV4 {
+		newDecoder = parser.NewV4PayloadDecoder
+	}
+	decoder := newDecoder(r.Body)
+	for {
+		d, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			transport.ReportError(s.callback, s, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.callback.OnPacket(d)
+		d.Close()
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Write([]byte("ok"))
+}
+
+// done calls callback.OnClose once when server is closing and no request is being served.
+func (s *Server) done() {
+	s.locker.Lock()
+	if s.state != stateClosing || s.active > 0 {
+		s.locker.Unlock()
+		return
+	}
+	s.state = stateClosed
+	s.locker.Unlock()
+
+	s.callback.OnClose(s)
+}
+
+func (s *Server) getState() state {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.state
+}
+
+type writer struct {
+	*parser.PacketEncoder
+	buf    *bytes.Buffer
+	server *Server
+}
+
+func (w *writer) Close() error {
+	if err := w.PacketEncoder.Close(); err != nil {
+		return err
+	}
+	// binary packets are base64 encoded, only text ones can be invalid.
+	if !utf8.Valid(w.buf.Bytes()) {
+		return ErrInvalidUTF8
+	}
+	s := w.server
+	s.locker.Lock()
+	if s.state != stateNormal {
+		s.locker.Unlock()
+		return errors.New("use of closed network connection")
+	}
+	s.buffers = append(s.buffers, w.buf.Bytes())
+	s.locker.Unlock()
+
+	select {
+	case s.sendChan <- true:
+	default:
+	}
+	return nil
+}
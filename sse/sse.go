@@ -0,0 +1,52 @@
+package sse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+// Creater is the creater of server-sent events transport. It isn't registered by default, use engineio.RegisterTransport to enable it.
+var Creater = transport.Creater{
+	Name:      "sse",
+	Upgrading: true,
+	Server:    NewServer,
+	Client:    NewClient,
+}
+
+type state int
+
+const (
+	stateUnknow state = iota
+	stateNormal
+	stateClosing
+	stateClosed
+)
+
+// ErrInvalidUTF8 is returned by closing the writer of a text packet which isn't valid UTF-8, which can't be sent as event without changing it.
+var ErrInvalidUTF8 = errors.New("sse: text packet isn't valid utf-8")
+
+// encodeEvent encodes packet as event. Packet is quoted as json string, so it never breaks event lines. It must be valid UTF-8, or json replaces invalid bytes.
+func encodeEvent(packet []byte) []byte {
+	data, _ := json.Marshal(string(packet))
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	return buf.Bytes()
+}
+
+func decodeEvent(protocol int, data []byte) (*parser.PacketDecoder, error) {
+	var packet string
+	if err := json.Unmarshal(data, &packet); err != nil {
+		return nil, err
+	}
+	if protocol == parser.ProtocolV4 && len(packet) > 0 && packet[0] == 'b' {
+		return parser.NewRawDecoder(base64.NewDecoder(base64.StdEncoding, bytes.NewBufferString(packet[1:])))
+	}
+	return parser.NewDecoder(bytes.NewBufferString(packet))
+}
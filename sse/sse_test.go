@@ -0,0 +1,203 @@
+package sse
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+func TestSSE(t *testing.T) {
+	for _, query := range []string{"", "?EIO=4"} {
+		Convey("Normal "+query, t, func() {
+			s := newServer()
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			req, err := http.NewRequest("GET", server.URL+query, nil)
+			So(err, ShouldBeNil)
+			client, err := NewClient(req)
+			So(err, ShouldBeNil)
+
+			So(client.Response().StatusCode, ShouldEqual, http.StatusOK)
+			So(client.Response().Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+
+			sync := make(chan int)
+			go func() {
+				<-s.callback.onPacket
+				sync <- 1
+			}()
+
+			{
+				w, err := client.NextWriter(message.MessageBinary, parser.MESSAGE)
+				So(err, ShouldBeNil)
+				_, err = w.Write([]byte("123"))
+				So(err, ShouldBeNil)
+				err = w.Close()
+				So(err, ShouldBeNil)
+			}
+
+			{
+				<-sync
+				So(s.callback.messageType, ShouldEqual, message.MessageBinary)
+				So(s.callback.packetType, ShouldEqual, parser.MESSAGE)
+				So(s.callback.body, ShouldResemble, []byte("123"))
+			}
+
+			packets := []struct {
+				messageType message.MessageType
+				data        string
+			}{
+				{message.MessageText, "abc"},
+				{message.MessageText, "line1\nline2\r\n"},
+				{message.MessageBinary, "\x00\x01\n\x02"},
+			}
+			for _, p := range packets {
+				w, err := s.server().NextWriter(p.messageType, parser.MESSAGE)
+				So(err, ShouldBeNil)
+				_, err = w.Write([]byte(p.data))
+				So(err, ShouldBeNil)
+				So(w.Close(), ShouldBeNil)
+			}
+			for _, p := range packets {
+				r, err := client.NextReader()
+				So(err, ShouldBeNil)
+				So(r.Type(), ShouldEqual, parser.MESSAGE)
+				So(r.MessageType(), ShouldEqual, p.messageType)
+				b, err := ioutil.ReadAll(r)
+				So(err, ShouldBeNil)
+				So(string(b), ShouldEqual, p.data)
+				So(r.Close(), ShouldBeNil)
+			}
+
+			Convey("Close by server", func() {
+				So(s.server().Close(), ShouldBeNil)
+				_, err := client.NextReader()
+				So(err, ShouldNotBeNil)
+				So(s.callback.ClosedCount(), ShouldEqual, 1)
+
+				_, err = s.server().NextWriter(message.MessageText, parser.MESSAGE)
+				So(err, ShouldNotBeNil)
+
+				w, err := client.NextWriter(message.MessageText, parser.MESSAGE)
+				So(err, ShouldBeNil)
+				So(w.Close(), ShouldNotBeNil)
+				client.Close()
+			})
+
+			Convey("Close by client", func() {
+				So(client.Close(), ShouldBeNil)
+				time.Sleep(time.Second / 10)
+				So(s.callback.ClosedCount(), ShouldEqual, 1)
+
+				_, err := client.NextWriter(message.MessageText, parser.MESSAGE)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	}
+
+	Convey("Invalid UTF-8", t, func() {
+		s, err := NewServer(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), newFakeCallback())
+		So(err, ShouldBeNil)
+		defer s.Close()
+
+		w, err := s.NextWriter(message.MessageText, parser.MESSAGE)
+		So(err, ShouldBeNil)
+		_, err = w.Write([]byte("a\xffb"))
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldEqual, ErrInvalidUTF8)
+		So(s.(transport.BufferedServer).Buffered(), ShouldEqual, 0)
+
+		w, err = s.NextWriter(message.MessageBinary, parser.MESSAGE)
+		So(err, ShouldBeNil)
+		_, err = w.Write([]byte("a\xffb"))
+		So(err, ShouldBeNil)
+		So(w.Close(), ShouldBeNil)
+		So(s.(transport.BufferedServer).Buffered(), ShouldEqual, 1)
+	})
+
+	Convey("Overlay get", t, func() {
+		s := newServer()
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		req, err := http.NewRequest("GET", server.URL, nil)
+		So(err, ShouldBeNil)
+		client, err := NewClient(req)
+		So(err, ShouldBeNil)
+		defer client.Close()
+
+		_, err = NewClient(req)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+type server struct {
+	callback *fakeCallback
+	locker   sync.Mutex
+	s        transport.Server
+}
+
+func newServer() *server {
+	return &server{
+		callback: newFakeCallback(),
+	}
+}
+
+func (s *server) server() transport.Server {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.s
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.locker.Lock()
+	if s.s == nil {
+		s.s, _ = NewServer(w, r, s.callback)
+	}
+	t := s.s
+	s.locker.Unlock()
+	t.ServeHTTP(w, r)
+}
+
+type fakeCallback struct {
+	onPacket    chan bool
+	messageType message.MessageType
+	packetType  parser.PacketType
+	body        []byte
+	err         error
+	closedCount int
+	countLocker sync.Mutex
+}
+
+func newFakeCallback() *fakeCallback {
+	return &fakeCallback{
+		onPacket: make(chan bool),
+	}
+}
+
+func (f *fakeCallback) OnPacket(r *parser.PacketDecoder) {
+	f.packetType = r.Type()
+	f.messageType = r.MessageType()
+	f.body, f.err = ioutil.ReadAll(r)
+	f.onPacket <- true
+}
+
+func (f *fakeCallback) OnClose(s transport.Server) {
+	f.countLocker.Lock()
+	defer f.countLocker.Unlock()
+	f.closedCount++
+}
+
+func (f *fakeCallback) ClosedCount() int {
+	f.countLocker.Lock()
+	defer f.countLocker.Unlock()
+	return f.closedCount
+}
@@ -0,0 +1,162 @@
+package engineio
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/teltechsystems/go-engine.io/parser"
+)
+
+// Stats is the snapshot of connection statistics.
+type Stats struct {
+	// BytesIn and BytesOut are the payload bytes of packets received and sent.
+	BytesIn  int64
+	BytesOut int64
+
+	// PacketsIn and PacketsOut are the count of packets received and sent, including control packets like PING and PONG.
+	PacketsIn  int64
+	PacketsOut int64
+
+	// MessagesIn and MessagesOut are the count of messages received and sent by message type.
+	MessagesIn  map[MessageType]int64
+	MessagesOut map[MessageType]int64
+
+	// Transport is the name of current transport.
+	Transport string
+
+	// UpgradedAt is the time when transport is upgraded, or zero if it's never upgraded.
+	UpgradedAt time.Time
+
+	// LastPacketAt is the time when last packet is received.
+	LastPacketAt time.Time
+
+	// RTT is the round trip time between last PING sent and its PONG received, or zero if it's never measured.
+	RTT time.Duration
+}
+
+type connStats struct {
+	locker       sync.Mutex
+	bytesIn      int64
+	bytesOut     int64
+	packetsIn    int64
+	packetsOut   int64
+	messagesIn   map[MessageType]int64
+	messagesOut  map[MessageType]int64
+	upgradedAt   time.Time
+	lastPacketAt time.Time
+	pingAt       time.Time
+	rtt          time.Duration
+}
+
+func (s *connStats) snapshot(transport string) Stats {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	ret := Stats{
+		BytesIn:      s.bytesIn,
+		BytesOut:     s.bytesOut,
+		PacketsIn:    s.packetsIn,
+		PacketsOut:   s.packetsOut,
+		MessagesIn:   make(map[MessageType]int64, len(s.messagesIn)),
+		MessagesOut:  make(map[MessageType]int64, len(s.messagesOut)),
+		Transport:    transport,
+		UpgradedAt:   s.upgradedAt,
+		LastPacketAt: s.lastPacketAt,
+		RTT:          s.rtt,
+	}
+	for k, v := range s.messagesIn {
+		ret.MessagesIn[k] = v
+	}
+	for k, v := range s.messagesOut {
+		ret.MessagesOut[k] = v
+	}
+	return ret
+}
+
+// onReceive records a received packet, and measures RTT if it's the PONG of last PING.
+func (s *connStats) onReceive(r *parser.PacketDecoder) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	now := time.Now()
+	s.packetsIn++
+	s.lastPacketAt = now
+	switch r.Type() {
+	case parser.MESSAGE:
+		if s.messagesIn == nil {
+			s.messagesIn = make(map[MessageType]int64)
+		}
+		s.messagesIn[MessageType(r.MessageType())]++
+	case parser.PONG:
+		if !s.pingAt.IsZero() {
+			s.rtt = now.Sub(s.pingAt)
+			s.pingAt = time.Time{}
+		}
+	}
+}
+
+func (s *connStats) onSend(t MessageType, typ parser.PacketType, n int64) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.packetsOut++
+	s.bytesOut += n
+	switch typ {
+	case parser.MESSAGE:
+		if s.messagesOut == nil {
+			s.messagesOut = make(map[MessageType]int64)
+		}
+		s.messagesOut[t]++
+	case parser.PING:
+		s.pingAt = time.Now()
+	}
+}
+
+func (s *connStats) addBytesIn(n int64) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.bytesIn += n
+}
+
+func (s *connStats) onUpgrade() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.upgradedAt = time.Now()
+}
+
+// writer wraps w to record the packet when it's closed.
+func (s *connStats) writer(w io.WriteCloser, t MessageType, typ parser.PacketType) io.WriteCloser {
+	return &statsWriter{
+		WriteCloser: w,
+		stats:       s,
+		t:           t,
+		typ:         typ,
+	}
+}
+
+type statsWriter struct {
+	io.WriteCloser
+	stats  *connStats
+	t      MessageType
+	typ    parser.PacketType
+	n      int64
+	closed bool
+}
+
+func (w *statsWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *statsWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if !w.closed && err == nil {
+		w.stats.onSend(w.t, w.typ, w.n)
+	}
+	w.closed = true
+	return err
+}
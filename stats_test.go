@@ -0,0 +1,81 @@
+package engineio
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStats(t *testing.T) {
+	Convey("Stats", t, func() {
+		server, h := newEchoServer()
+		defer h.Close()
+		events := newHookEvents(server)
+
+		conn, err := Dial(h.URL, nil)
+		So(err, ShouldBeNil)
+		defer conn.Close()
+		serverConn := <-events.connections
+		select {
+		case <-events.upgrades:
+		case <-time.After(5 * time.Second):
+			So("upgraded", ShouldBeEmpty)
+		}
+
+		for _, m := range []struct {
+			t    MessageType
+			data string
+		}{{MessageText, "hello"}, {MessageBinary, "ab"}} {
+			So(writeMessage(conn, m.t, []byte(m.data)), ShouldBeNil)
+			_, r, err := conn.NextReader()
+			So(err, ShouldBeNil)
+			b, err := ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			r.Close()
+			So(string(b), ShouldEqual, m.data)
+		}
+		// wait for a round of ping.
+		time.Sleep(time.Second)
+
+		stats := serverConn.(StatsConn).Stats()
+		So(stats.Transport, ShouldEqual, "websocket")
+		So(stats.MessagesIn, ShouldResemble, map[MessageType]int64{MessageText: 1, MessageBinary: 1})
+		So(stats.MessagesOut, ShouldResemble, map[MessageType]int64{MessageText: 1, MessageBinary: 1})
+		So(stats.BytesIn, ShouldBeGreaterThanOrEqualTo, 7)
+		So(stats.BytesOut, ShouldBeGreaterThanOrEqualTo, 7)
+		So(stats.PacketsIn, ShouldBeGreaterThan, 2)
+		So(stats.PacketsOut, ShouldBeGreaterThan, 2)
+		So(stats.UpgradedAt.IsZero(), ShouldBeFalse)
+		So(time.Since(stats.LastPacketAt), ShouldBeLessThan, time.Second)
+		So(stats.RTT, ShouldBeGreaterThan, 0)
+		So(stats.RTT, ShouldBeLessThan, time.Second)
+
+		stats = conn.(StatsConn).Stats()
+		So(stats.Transport, ShouldEqual, "websocket")
+		So(stats.MessagesIn, ShouldResemble, map[MessageType]int64{MessageText: 1, MessageBinary: 1})
+		So(stats.MessagesOut, ShouldResemble, map[MessageType]int64{MessageText: 1, MessageBinary: 1})
+		So(stats.BytesIn, ShouldEqual, 7)
+		So(stats.UpgradedAt.IsZero(), ShouldBeFalse)
+
+		Convey("concurrently", func() {
+			wg := sync.WaitGroup{}
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					serverConn.(StatsConn).Stats()
+					conn.(StatsConn).Stats()
+				}()
+			}
+			wg.Wait()
+		})
+	})
+
+	Convey("Stats of reconnecting conn without StatsConn", t, func() {
+		c := &reconnectConn{lastConn: newSlowConn()}
+		So(c.Stats(), ShouldResemble, Stats{})
+	})
+}
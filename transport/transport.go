@@ -3,16 +3,56 @@ package transport
 import (
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/metrics"
 	"github.com/teltechsystems/go-engine.io/parser"
 )
 
+// Protocol returns the protocol revision which request r asks by EIO query. It returns 0 if the revision isn't supported. Request without EIO is treated as revision 3.
+func Protocol(r *http.Request) int {
+	switch r.URL.Query().Get("EIO") {
+	case "", "3":
+		return parser.ProtocolV3
+	case "4":
+		return parser.ProtocolV4
+	}
+	return 0
+}
+
 type Callback interface {
 	OnPacket(r *parser.PacketDecoder)
 	OnClose(server Server)
 }
 
+// ErrorCallback is an optional interface of Callback. Transports report errors which break the connection to it, before calling OnClose.
+type ErrorCallback interface {
+	OnError(server Server, err error)
+}
+
+// ReportError reports err of server to callback if callback implements ErrorCallback.
+func ReportError(callback Callback, server Server, err error) {
+	if c, ok := callback.(ErrorCallback); ok {
+		c.OnError(server, err)
+	}
+}
+
+// MetricsCallback is an optional interface of Callback. Transports report their metrics to the Metrics it returns.
+type MetricsCallback interface {
+	Metrics() metrics.Metrics
+}
+
+// MetricsOf returns the Metrics of callback, or metrics.Nop if callback doesn't implement MetricsCallback.
+func MetricsOf(callback Callback) metrics.Metrics {
+	if c, ok := callback.(MetricsCallback); ok {
+		if m := c.Metrics(); m != nil {
+			return m
+		}
+	}
+	return metrics.Nop{}
+}
+
 type Creater struct {
 	Name      string
 	Upgrading bool
@@ -33,6 +73,18 @@ type Server interface {
 	NextWriter(messageType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error)
 }
 
+// BufferedServer is an optional interface of Server, which queues packets until client fetches them, like polling.
+type BufferedServer interface {
+	// Buffered returns the number of packets waiting to be sent.
+	Buffered() int
+}
+
+// PreparedWriter is an optional interface of Server, which sends a prepared packet without encoding it again. Calls should be synced with NextWriter.
+type PreparedWriter interface {
+	// WritePrepared sends p. If deadline isn't zero, a blocking write fails with a timeout error after it.
+	WritePrepared(p *parser.PreparedPacket, deadline time.Time) error
+}
+
 // Client is a transport layer in client to connect server.
 type Client interface {
 
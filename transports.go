@@ -0,0 +1,55 @@
+package engineio
+
+import (
+	"sync"
+
+	"github.com/teltechsystems/go-engine.io/polling"
+	"github.com/teltechsystems/go-engine.io/transport"
+	"github.com/teltechsystems/go-engine.io/websocket"
+)
+
+type transportCreaters []transport.Creater
+
+func (c transportCreaters) Get(name string) transport.Creater {
+	for _, creater := range c {
+		if creater.Name == name {
+			return creater
+		}
+	}
+	return transport.Creater{}
+}
+
+// with returns creaters with c, which replaces the creater with the same name, or is appended.
+func (c transportCreaters) with(creater transport.Creater) transportCreaters {
+	for i, cr := range c {
+		if cr.Name == creater.Name {
+			c[i] = creater
+			return c
+		}
+	}
+	return append(c, creater)
+}
+
+var registry = struct {
+	creaters transportCreaters
+	locker   sync.RWMutex
+}{
+	creaters: transportCreaters{polling.Creater, websocket.Creater},
+}
+
+// RegisterTransport registers transport creater c, so server can be created with it by name. Creater with the same name will be replaced, otherwise it's appended after registered ones. "polling" and "websocket" are registered by default.
+func RegisterTransport(c transport.Creater) {
+	registry.locker.Lock()
+	defer registry.locker.Unlock()
+
+	registry.creaters = registry.creaters.with(c)
+}
+
+func registeredTransports() transportCreaters {
+	registry.locker.RLock()
+	defer registry.locker.RUnlock()
+
+	ret := make(transportCreaters, len(registry.creaters))
+	copy(ret, registry.creaters)
+	return ret
+}
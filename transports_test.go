@@ -0,0 +1,169 @@
+package engineio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/polling"
+	"github.com/teltechsystems/go-engine.io/sse"
+	"github.com/teltechsystems/go-engine.io/transport"
+	"github.com/teltechsystems/go-engine.io/websocket"
+)
+
+func TestRegisterTransport(t *testing.T) {
+	Convey("Register transport", t, func() {
+		saved := registeredTransports()
+		defer func() {
+			registry.locker.Lock()
+			registry.creaters = saved
+			registry.locker.Unlock()
+		}()
+
+		fake := transport.Creater{
+			Name:      "fake",
+			Upgrading: true,
+			Server:    websocket.NewServer,
+			Client:    websocket.NewClient,
+		}
+		static := transport.Creater{
+			Name:      "static",
+			Upgrading: false,
+			Server:    polling.NewServer,
+			Client:    polling.NewClient,
+		}
+
+		_, err := NewServer([]string{"fake"})
+		So(err, ShouldEqual, InvalidError)
+
+		RegisterTransport(fake)
+		RegisterTransport(static)
+		RegisterTransport(fake)
+
+		names := []string{}
+		for _, c := range registeredTransports() {
+			names = append(names, c.Name)
+		}
+		So(names, ShouldResemble, []string{"polling", "websocket", "fake", "static"})
+
+		Convey("Upgrades in handshake", func() {
+			server, err := NewServer(nil)
+			So(err, ShouldBeNil)
+			go server.Accept()
+
+			upgrades := func() []interface{} {
+				res := httptest.NewRecorder()
+				server.ServeHTTP(res, newOpenReq())
+				So(res.Code, ShouldEqual, http.StatusOK)
+				packet, err := parser.NewPayloadDecoder(res.Body).Next()
+				So(err, ShouldBeNil)
+				openRes := map[string]interface{}{}
+				So(json.NewDecoder(packet).Decode(&openRes), ShouldBeNil)
+				return openRes["upgrades"].([]interface{})
+			}
+
+			Convey("ordered and only upgrading ones", func() {
+				So(upgrades(), ShouldResemble, []interface{}{"websocket", "fake"})
+			})
+
+			Convey("no upgrades when not allowed", func() {
+				server.SetAllowUpgrades(false)
+				So(upgrades(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("Server with given transports", func() {
+			server, err := NewServer([]string{"fake", "polling"})
+			So(err, ShouldBeNil)
+			So(server.transports().Get("fake").Name, ShouldEqual, "fake")
+			So(server.transports().Get("websocket").Name, ShouldEqual, "")
+		})
+	})
+}
+
+func TestTransportCreaters(t *testing.T) {
+	Convey("Transport creaters of server", t, func() {
+		fake := transport.Creater{
+			Name:      "fake",
+			Upgrading: true,
+			Server:    websocket.NewServer,
+			Client:    websocket.NewClient,
+		}
+		server, err := NewServerWithOptions(WithTransportCreaters(fake), WithTransports("polling", "fake"))
+		So(err, ShouldBeNil)
+		So(server.transports().Get("fake").Name, ShouldEqual, "fake")
+		So(registeredTransports().Get("fake").Name, ShouldEqual, "")
+
+		Convey("All transports by default", func() {
+			server, err := NewServerWithOptions(WithTransportCreaters(fake))
+			So(err, ShouldBeNil)
+			names := []string{}
+			for _, c := range server.transports() {
+				names = append(names, c.Name)
+			}
+			So(names, ShouldResemble, []string{"polling", "websocket", "fake"})
+		})
+
+		Convey("Replace registered one", func() {
+			server, err := NewServerWithOptions(WithTransportCreaters(transport.Creater{
+				Name:   "websocket",
+				Server: polling.NewServer,
+				Client: polling.NewClient,
+			}))
+			So(err, ShouldBeNil)
+			So(server.transports().Get("websocket").Upgrading, ShouldBeFalse)
+			So(registeredTransports().Get("websocket").Upgrading, ShouldBeTrue)
+		})
+
+		Convey("Can't be reconfigured", func() {
+			err := server.Reconfigure(false, WithTransportCreaters(fake))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSSETransport(t *testing.T) {
+	Convey("Upgrade to sse", t, func() {
+		saved := registeredTransports()
+		defer func() {
+			registry.locker.Lock()
+			registry.creaters = saved
+			registry.locker.Unlock()
+		}()
+		RegisterTransport(sse.Creater)
+
+		server, h := newEchoServer()
+		defer h.Close()
+
+		for _, protocol := range []int{parser.ProtocolV3, parser.ProtocolV4} {
+			conn, err := Dial(h.URL, &DialOptions{
+				Transports: []transport.Creater{polling.Creater, sse.Creater},
+				Protocol:   protocol,
+			})
+			So(err, ShouldBeNil)
+
+			rt, data := echo(conn, MessageText, "hello")
+			So(rt, ShouldEqual, MessageText)
+			So(data, ShouldEqual, "hello")
+
+			time.Sleep(time.Second / 2)
+			So(conn.(*clientConn).getCurrentName(), ShouldEqual, "sse")
+
+			rt, data = echo(conn, MessageBinary, "\x01\n\x02")
+			So(rt, ShouldEqual, MessageBinary)
+			So(data, ShouldEqual, "\x01\n\x02")
+
+			time.Sleep(time.Second * 2)
+			rt, data = echo(conn, MessageText, "still alive")
+			So(data, ShouldEqual, "still alive")
+
+			So(conn.Close(), ShouldBeNil)
+			time.Sleep(time.Second / 2)
+			So(server.Count(), ShouldEqual, 0)
+		}
+	})
+}
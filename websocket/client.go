@@ -11,21 +11,30 @@ import (
 )
 
 type client struct {
-	conn *websocket.Conn
-	resp *http.Response
+	conn     *websocket.Conn
+	resp     *http.Response
+	protocol int
 }
 
 func NewClient(r *http.Request) (transport.Client, error) {
 	dialer := websocket.DefaultDialer
 
-	conn, resp, err := dialer.Dial(r.URL.String(), r.Header)
+	u := *r.URL
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	conn, resp, err := dialer.Dial(u.String(), r.Header)
 	if err != nil {
 		return nil, err
 	}
 
 	return &client{
-		conn: conn,
-		resp: resp,
+		conn:     conn,
+		resp:     resp,
+		protocol: transport.Protocol(r),
 	}, nil
 }
 
@@ -34,7 +43,6 @@ func (c *client) Response() *http.Response {
 }
 
 func (c *client) NextReader() (*parser.PacketDecoder, error) {
-	var reader io.Reader
 	for {
 		t, r, err := c.conn.NextReader()
 		if err != nil {
@@ -44,27 +52,13 @@ func (c *client) NextReader() (*parser.PacketDecoder, error) {
 		case websocket.TextMessage:
 			fallthrough
 		case websocket.BinaryMessage:
-			reader = r
-			return parser.NewDecoder(reader)
+			return newDecoder(c.protocol, t, r)
 		}
 	}
 }
 
 func (c *client) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
-	wsType, newEncoder := websocket.TextMessage, parser.NewStringEncoder
-	if msgType == message.MessageBinary {
-		wsType, newEncoder = websocket.BinaryMessage, parser.NewBinaryEncoder
-	}
-
-	w, err := c.conn.NextWriter(wsType)
-	if err != nil {
-		return nil, err
-	}
-	ret, err := newEncoder(w, packetType)
-	if err != nil {
-		return nil, err
-	}
-	return ret, nil
+	return nextWriter(c.conn, c.protocol, msgType, packetType)
 }
 
 func (c *client) Close() error {
@@ -3,27 +3,33 @@ package websocket
 import (
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/metrics"
 	"github.com/teltechsystems/go-engine.io/parser"
 	"github.com/teltechsystems/go-engine.io/transport"
 )
 
 type Server struct {
 	callback transport.Callback
+	metrics  metrics.Metrics
 	conn     *websocket.Conn
+	protocol int
 }
 
 func NewServer(w http.ResponseWriter, r *http.Request, callback transport.Callback) (transport.Server, error) {
-	conn, err := websocket.Upgrade(w, r, nil, 10240, 10240)
+	conn, err := websocket.Upgrade(w, r, w.Header(), 10240, 10240)
 	if err != nil {
 		return nil, err
 	}
 
 	ret := &Server{
 		callback: callback,
+		metrics:  transport.MetricsOf(callback),
 		conn:     conn,
+		protocol: transport.Protocol(r),
 	}
 
 	go ret.serveHTTP(w, r)
@@ -32,24 +38,42 @@ func NewServer(w http.ResponseWriter, r *http.Request, callback transport.Callba
 }
 
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		// the upgrade request is served by NewServer, and its connection is hijacked.
+		return
+	}
 	w.WriteHeader(http.StatusBadRequest)
 }
 
 func (s *Server) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
-	wsType, newEncoder := websocket.TextMessage, parser.NewStringEncoder
-	if msgType == message.MessageBinary {
-		wsType, newEncoder = websocket.BinaryMessage, parser.NewBinaryEncoder
+	w, err := nextWriter(s.conn, s.protocol, msgType, packetType)
+	if err != nil {
+		return nil, err
 	}
+	return &frameWriter{
+		WriteCloser: w,
+		metrics:     s.metrics,
+	}, nil
+}
 
-	w, err := s.conn.NextWriter(wsType)
+// WritePrepared sends prepared packet p as a frame, reusing its encoding shared with other connections of the same protocol. The write fails after deadline if peer doesn't read, and the connection can't be written any more then.
+func (s *Server) WritePrepared(p *parser.PreparedPacket, deadline time.Time) error {
+	wsType, encoding := format(s.protocol, p.MessageType(), p.Type())
+	b, err := p.Encode(encoding)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	ret, err := newEncoder(w, packetType)
+	if err := s.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	err = s.conn.WriteMessage(wsType, b)
+	s.conn.SetWriteDeadline(time.Time{})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return ret, nil
+	s.metrics.WebsocketFrame(metrics.Out)
+	s.metrics.PayloadSize("websocket", metrics.Out, len(b))
+	return nil
 }
 
 func (s *Server) Close() error {
@@ -62,6 +86,9 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 	for {
 		t, r, err := s.conn.NextReader()
 		if err != nil {
+			if _, closed := err.(*websocket.CloseError); !closed {
+				transport.ReportError(s.callback, s, err)
+			}
 			s.conn.Close()
 			return
 		}
@@ -70,12 +97,51 @@ func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
 		case websocket.TextMessage:
 			fallthrough
 		case websocket.BinaryMessage:
-			decoder, err := parser.NewDecoder(r)
+			s.metrics.WebsocketFrame(metrics.In)
+			frame := &frameReader{Reader: r}
+			decoder, err := newDecoder(s.protocol, t, frame)
 			if err != nil {
+				transport.ReportError(s.callback, s, err)
+				s.conn.Close()
 				return
 			}
 			s.callback.OnPacket(decoder)
 			decoder.Close()
+			s.metrics.PayloadSize("websocket", metrics.In, frame.n)
 		}
 	}
 }
+
+// frameReader counts the bytes of received frame.
+type frameReader struct {
+	io.Reader
+	n int
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+	return n, err
+}
+
+// frameWriter reports the sent frame to metrics when it's closed.
+type frameWriter struct {
+	io.WriteCloser
+	metrics metrics.Metrics
+	n       int
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.n += n
+	return n, err
+}
+
+func (w *frameWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.metrics.WebsocketFrame(metrics.Out)
+	w.metrics.PayloadSize("websocket", metrics.Out, w.n)
+	return nil
+}
@@ -1,6 +1,11 @@
 package websocket
 
 import (
+	"io"
+
+	"github.com/gorilla/websocket"
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
 	"github.com/teltechsystems/go-engine.io/transport"
 )
 
@@ -10,3 +15,46 @@ var Creater = transport.Creater{
 	Server:    NewServer,
 	Client:    NewClient,
 }
+
+// format returns the websocket message type and packet encoding of a packet.
+func format(protocol int, msgType message.MessageType, packetType parser.PacketType) (int, parser.Encoding) {
+	if msgType != message.MessageBinary {
+		return websocket.TextMessage, parser.EncodingString
+	}
+	if protocol != parser.ProtocolV4 {
+		return websocket.BinaryMessage, parser.EncodingBinary
+	}
+	// protocol v4 sends binary message as is, and has no binary for other packets.
+	if packetType == parser.MESSAGE {
+		return websocket.BinaryMessage, parser.EncodingRaw
+	}
+	return websocket.TextMessage, parser.EncodingString
+}
+
+func nextWriter(conn *websocket.Conn, protocol int, msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	wsType, encoding := format(protocol, msgType, packetType)
+	w, err := conn.NextWriter(wsType)
+	if err != nil {
+		return nil, err
+	}
+	var ret *parser.PacketEncoder
+	switch encoding {
+	case parser.EncodingRaw:
+		ret, err = parser.NewRawEncoder(w)
+	case parser.EncodingBinary:
+		ret, err = parser.NewBinaryEncoder(w, packetType)
+	default:
+		ret, err = parser.NewStringEncoder(w, packetType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func newDecoder(protocol int, wsType int, r io.Reader) (*parser.PacketDecoder, error) {
+	if protocol == parser.ProtocolV4 && wsType == websocket.BinaryMessage {
+		return parser.NewRawDecoder(r)
+	}
+	return parser.NewDecoder(r)
+}
@@ -310,6 +310,75 @@ func TestWebsocket(t *testing.T) {
 		sync <- 1
 	})
 
+	Convey("Packet content v4", t, func() {
+		f := newFakeCallback()
+		sync := make(chan int)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, _ := NewServer(w, r, f)
+			defer s.Close()
+
+			{
+				w, _ := s.NextWriter(message.MessageBinary, parser.MESSAGE)
+				w.Write([]byte{1, 2, 3, 4})
+				w.Close()
+			}
+
+			{
+				w, _ := s.NextWriter(message.MessageBinary, parser.PING)
+				w.Write([]byte("probe"))
+				w.Close()
+			}
+
+			sync <- 1
+			<-sync
+		}))
+		defer server.Close()
+
+		u, err := url.Parse(server.URL)
+		So(err, ShouldBeNil)
+		u.Scheme = "ws"
+		req, err := http.NewRequest("GET", u.String()+"/?EIO=4", nil)
+		So(err, ShouldBeNil)
+
+		c, err := NewClient(req)
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		{
+			client := c.(*client)
+			t, r, err := client.conn.NextReader()
+			So(err, ShouldBeNil)
+			So(t, ShouldEqual, websocket.BinaryMessage)
+			b, err := ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(b, ShouldResemble, []byte{1, 2, 3, 4})
+		}
+
+		{
+			decoder, err := c.NextReader()
+			So(err, ShouldBeNil)
+			So(decoder.MessageType(), ShouldEqual, message.MessageText)
+			So(decoder.Type(), ShouldEqual, parser.PING)
+			b, err := ioutil.ReadAll(decoder)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "probe")
+		}
+
+		{
+			w, err := c.NextWriter(message.MessageBinary, parser.MESSAGE)
+			So(err, ShouldBeNil)
+			w.Write([]byte{5, 6})
+			w.Close()
+		}
+
+		<-sync
+		<-f.onPacket
+		So(f.packetType, ShouldEqual, parser.MESSAGE)
+		So(f.messageType, ShouldEqual, message.MessageBinary)
+		So(f.body, ShouldResemble, []byte{5, 6})
+		sync <- 1
+	})
+
 	Convey("Close", t, func() {
 		f := newFakeCallback()
 		var s transport.Server
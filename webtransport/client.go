@@ -0,0 +1,77 @@
+package webtransport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	wt "github.com/quic-go/webtransport-go"
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+type client struct {
+	session *wt.Session
+	stream  *stream
+	resp    *http.Response
+}
+
+// NewClient dials request r with dialer d, opens the stream and sends the OPEN packet, which carries sid if r has it.
+func NewClient(d *wt.Dialer, r *http.Request) (transport.Client, error) {
+	if transport.Protocol(r) != parser.ProtocolV4 {
+		return nil, fmt.Errorf("webtransport needs protocol v4")
+	}
+	u := *r.URL
+	u.Scheme = "https"
+
+	ctx, cancel := context.WithTimeout(context.Background(), HandshakeTimeout)
+	defer cancel()
+	resp, session, err := d.Dial(ctx, u.String(), r.Header.Clone())
+	if err != nil {
+		return nil, err
+	}
+	str, err := session.OpenStreamSync(ctx)
+	if err != nil {
+		session.CloseWithError(0, err.Error())
+		return nil, err
+	}
+	ret := &client{
+		session: session,
+		stream:  newStream(str),
+		resp:    resp,
+	}
+
+	w, err := ret.NextWriter(message.MessageText, parser.OPEN)
+	if err == nil {
+		if sid := r.URL.Query().Get("sid"); sid != "" {
+			err = json.NewEncoder(w).Encode(map[string]string{"sid": sid})
+		}
+		if err == nil {
+			err = w.Close()
+		}
+	}
+	if err != nil {
+		session.CloseWithError(0, err.Error())
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (c *client) Response() *http.Response {
+	return c.resp
+}
+
+func (c *client) NextReader() (*parser.PacketDecoder, error) {
+	return c.stream.nextReader()
+}
+
+func (c *client) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	return c.stream.nextWriter(msgType, packetType)
+}
+
+func (c *client) Close() error {
+	return c.session.CloseWithError(0, "")
+}
@@ -0,0 +1,95 @@
+package webtransport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	wt "github.com/quic-go/webtransport-go"
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+type Server struct {
+	callback transport.Callback
+	session  *wt.Session
+	stream   *stream
+}
+
+// NewServer upgrades request r with upgrader s, and waits for the client to open the stream and send the OPEN packet.
+func NewServer(s *wt.Server, w http.ResponseWriter, r *http.Request, callback transport.Callback) (transport.Server, error) {
+	if s == nil {
+		return nil, InvalidError
+	}
+	if transport.Protocol(r) != parser.ProtocolV4 {
+		return nil, errors.New("webtransport needs protocol v4")
+	}
+	session, err := s.Upgrade(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(session.Context(), HandshakeTimeout)
+	defer cancel()
+	str, err := session.AcceptStream(ctx)
+	if err != nil {
+		session.CloseWithError(0, err.Error())
+		return nil, err
+	}
+	str.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	ret := &Server{
+		callback: callback,
+		session:  session,
+		stream:   newStream(str),
+	}
+	decoder, err := ret.stream.nextReader()
+	if err == nil && decoder.Type() != parser.OPEN {
+		err = errors.New("invalid handshake")
+	}
+	if err != nil {
+		session.CloseWithError(0, err.Error())
+		return nil, err
+	}
+	str.SetReadDeadline(time.Time{})
+
+	go ret.serveHTTP()
+
+	return ret, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "CONNECT" {
+		// the session is served by NewServer.
+		return
+	}
+	w.WriteHeader(http.StatusBadRequest)
+}
+
+func (s *Server) NextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	return s.stream.nextWriter(msgType, packetType)
+}
+
+func (s *Server) Close() error {
+	return s.session.CloseWithError(0, "")
+}
+
+func (s *Server) serveHTTP() {
+	defer s.callback.OnClose(s)
+
+	for {
+		decoder, err := s.stream.nextReader()
+		if err != nil {
+			var closed *wt.SessionError
+			if !errors.As(err, &closed) && err != io.EOF {
+				transport.ReportError(s.callback, s, err)
+			}
+			s.session.CloseWithError(0, "")
+			return
+		}
+		s.callback.OnPacket(decoder)
+		decoder.Close()
+	}
+}
@@ -0,0 +1,152 @@
+package webtransport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	wt "github.com/quic-go/webtransport-go"
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+var InvalidError = errors.New("invalid transport")
+
+// HandshakeTimeout is the max time to wait for the stream and its first packet of a new session.
+var HandshakeTimeout = 10 * time.Second
+
+// NewCreater returns the creater of webtransport transport. Server upgrades requests with s, which must serve the HTTP/3 listener of engine.io server. Client dials with d, or a default dialer if d is nil.
+//
+// WebTransport is only available in protocol v4. It isn't registered by default, use engineio.RegisterTransport to enable it.
+func NewCreater(s *wt.Server, d *wt.Dialer) transport.Creater {
+	if d == nil {
+		d = &wt.Dialer{}
+	}
+	return transport.Creater{
+		Name:      "webtransport",
+		Upgrading: true,
+		Server: func(w http.ResponseWriter, r *http.Request, callback transport.Callback) (transport.Server, error) {
+			return NewServer(s, w, r, callback)
+		},
+		Client: func(r *http.Request) (transport.Client, error) {
+			return NewClient(d, r)
+		},
+	}
+}
+
+// stream sends and receives packets in frames of engine.io-parser v5. Each frame has a header of payload length, the highest bit of its first byte marks binary payload.
+type stream struct {
+	str         *wt.Stream
+	reader      *bufio.Reader
+	current     *io.LimitedReader
+	writeLocker sync.Mutex
+}
+
+func newStream(str *wt.Stream) *stream {
+	return &stream{
+		str:    str,
+		reader: bufio.NewReader(str),
+	}
+}
+
+func (s *stream) nextReader() (*parser.PacketDecoder, error) {
+	if s.current != nil {
+		// skip what's left of last packet.
+		if _, err := io.Copy(ioutil.Discard, s.current); err != nil {
+			return nil, err
+		}
+		s.current = nil
+	}
+	b, err := s.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	isBinary := b&0x80 != 0
+	length := uint64(b & 0x7f)
+	switch length {
+	case 126:
+		var l uint16
+		if err := binary.Read(s.reader, binary.BigEndian, &l); err != nil {
+			return nil, err
+		}
+		length = uint64(l)
+	case 127:
+		if err := binary.Read(s.reader, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+	}
+	if length == 0 && !isBinary {
+		return nil, errors.New("invalid input")
+	}
+	s.current = &io.LimitedReader{R: s.reader, N: int64(length)}
+	if isBinary {
+		return parser.NewRawDecoder(s.current)
+	}
+	return parser.NewDecoder(s.current)
+}
+
+func (s *stream) nextWriter(msgType message.MessageType, packetType parser.PacketType) (io.WriteCloser, error) {
+	ret := &writer{
+		stream: s,
+		binary: msgType == message.MessageBinary && packetType == parser.MESSAGE,
+	}
+	var err error
+	if ret.binary {
+		ret.PacketEncoder, err = parser.NewRawEncoder(&ret.buf)
+	} else {
+		// binary of other packets isn't supported in protocol v4, sends as text.
+		ret.PacketEncoder, err = parser.NewStringEncoder(&ret.buf, packetType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *stream) writeFrame(isBinary bool, data []byte) error {
+	var header []byte
+	length := len(data)
+	switch {
+	case length < 126:
+		header = []byte{byte(length)}
+	case length < 65536:
+		header = make([]byte, 3)
+		header[0] = 126
+		binary.BigEndian.PutUint16(header[1:], uint16(length))
+	default:
+		header = make([]byte, 9)
+		header[0] = 127
+		binary.BigEndian.PutUint64(header[1:], uint64(length))
+	}
+	if isBinary {
+		header[0] |= 0x80
+	}
+
+	s.writeLocker.Lock()
+	defer s.writeLocker.Unlock()
+	if _, err := s.str.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+type writer struct {
+	*parser.PacketEncoder
+	buf    bytes.Buffer
+	stream *stream
+	binary bool
+}
+
+func (w *writer) Close() error {
+	if err := w.PacketEncoder.Close(); err != nil {
+		return err
+	}
+	return w.stream.writeFrame(w.binary, w.buf.Bytes())
+}
@@ -0,0 +1,287 @@
+package webtransport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	wt "github.com/quic-go/webtransport-go"
+	. "github.com/smartystreets/goconvey/convey"
+	engineio "github.com/teltechsystems/go-engine.io"
+	"github.com/teltechsystems/go-engine.io/message"
+	"github.com/teltechsystems/go-engine.io/parser"
+	"github.com/teltechsystems/go-engine.io/polling"
+	"github.com/teltechsystems/go-engine.io/transport"
+)
+
+func TestWebTransport(t *testing.T) {
+	Convey("Normal", t, func() {
+		callback := newFakeCallback()
+		serverChan := make(chan transport.Server, 1)
+		var creater transport.Creater
+		addr, closeServer := runServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, err := creater.Server(w, r, callback)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			serverChan <- s
+		}), func(s *wt.Server, d *wt.Dialer) {
+			creater = NewCreater(s, d)
+		})
+		defer closeServer()
+
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/engine.io/?EIO=4&transport=webtransport&sid=abc", addr), nil)
+		So(err, ShouldBeNil)
+		client, err := creater.Client(req)
+		So(err, ShouldBeNil)
+		So(client.Response().StatusCode, ShouldEqual, http.StatusOK)
+
+		server := <-serverChan
+
+		sizes := []int{0, 125, 126, 65535, 65536}
+		for _, size := range sizes {
+			for _, msgType := range []message.MessageType{message.MessageText, message.MessageBinary} {
+				data := make([]byte, size)
+				for i := range data {
+					data[i] = byte('a' + i%26)
+				}
+
+				w, err := client.NextWriter(msgType, parser.MESSAGE)
+				So(err, ShouldBeNil)
+				w.Write(data)
+				So(w.Close(), ShouldBeNil)
+
+				<-callback.onPacket
+				So(callback.packetType, ShouldEqual, parser.MESSAGE)
+				So(callback.messageType, ShouldEqual, msgType)
+				So(callback.body, ShouldResemble, data)
+
+				w, err = server.NextWriter(msgType, parser.MESSAGE)
+				So(err, ShouldBeNil)
+				w.Write(data)
+				So(w.Close(), ShouldBeNil)
+
+				r, err := client.NextReader()
+				So(err, ShouldBeNil)
+				So(r.Type(), ShouldEqual, parser.MESSAGE)
+				So(r.MessageType(), ShouldEqual, msgType)
+				b, err := ioutil.ReadAll(r)
+				So(err, ShouldBeNil)
+				So(len(b), ShouldEqual, size)
+				So(b, ShouldResemble, data)
+				r.Close()
+			}
+		}
+
+		Convey("Unread packet is skipped", func() {
+			for _, data := range []string{"skipped", "read"} {
+				w, err := server.NextWriter(message.MessageText, parser.MESSAGE)
+				So(err, ShouldBeNil)
+				w.Write([]byte(data))
+				So(w.Close(), ShouldBeNil)
+			}
+			_, err := client.NextReader()
+			So(err, ShouldBeNil)
+			r, err := client.NextReader()
+			So(err, ShouldBeNil)
+			b, err := ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "read")
+			client.Close()
+		})
+
+		Convey("Close by server", func() {
+			So(server.Close(), ShouldBeNil)
+			_, err := client.NextReader()
+			So(err, ShouldNotBeNil)
+			time.Sleep(time.Second / 10)
+			So(callback.ClosedCount(), ShouldEqual, 1)
+		})
+
+		Convey("Close by client", func() {
+			So(client.Close(), ShouldBeNil)
+			time.Sleep(time.Second / 10)
+			So(callback.ClosedCount(), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Upgrade from polling", t, func() {
+		var creater transport.Creater
+		var server *engineio.Server
+		upgraded := make(chan bool, 1)
+		addr, closeServer := runServer(nil, func(s *wt.Server, d *wt.Dialer) {
+			creater = NewCreater(s, d)
+			newServer := creater.Server
+			creater.Server = func(w http.ResponseWriter, r *http.Request, callback transport.Callback) (transport.Server, error) {
+				ret, err := newServer(w, r, callback)
+				if err == nil {
+					upgraded <- true
+				}
+				return ret, err
+			}
+			engineio.RegisterTransport(creater)
+			server, _ = engineio.NewServer([]string{"polling", "webtransport"})
+			s.H3.Handler = server
+		})
+		defer closeServer()
+		go func() {
+			for {
+				conn, err := server.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					for {
+						t, r, err := conn.NextReader()
+						if err != nil {
+							return
+						}
+						b, _ := ioutil.ReadAll(r)
+						r.Close()
+						w, err := conn.NextWriter(t)
+						if err != nil {
+							return
+						}
+						w.Write(b)
+						w.Close()
+					}
+				}()
+			}
+		}()
+
+		// polling runs on tcp with the same port number.
+		l, err := net.Listen("tcp", addr)
+		So(err, ShouldBeNil)
+		h := &http.Server{Handler: server}
+		go h.Serve(l)
+
+		conn, err := engineio.Dial("http://"+addr+"/engine.io/", &engineio.DialOptions{
+			Transports: []transport.Creater{polling.Creater, creater},
+		})
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		select {
+		case <-upgraded:
+		case <-time.After(time.Second * 5):
+		}
+		time.Sleep(time.Second / 10)
+		// packets go through webtransport only after upgraded.
+		h.Close()
+
+		for _, msgType := range []engineio.MessageType{engineio.MessageText, engineio.MessageBinary} {
+			w, err := conn.NextWriter(msgType)
+			So(err, ShouldBeNil)
+			w.Write([]byte("hello"))
+			So(w.Close(), ShouldBeNil)
+
+			t, r, err := conn.NextReader()
+			So(err, ShouldBeNil)
+			So(t, ShouldEqual, msgType)
+			b, err := ioutil.ReadAll(r)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldEqual, "hello")
+			r.Close()
+		}
+		So(server.Count(), ShouldEqual, 1)
+	})
+}
+
+// runServer runs HTTP/3 server with handler on a local udp port, using a self-signed certificate which the dialer trusts.
+func runServer(handler http.Handler, setup func(s *wt.Server, d *wt.Dialer)) (string, func()) {
+	cert, pool := selfSignedCert()
+	s := &wt.Server{
+		H3: &http3.Server{
+			Handler:   handler,
+			TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		},
+	}
+	wt.ConfigureHTTP3Server(s.H3)
+	d := &wt.Dialer{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}
+	setup(s, d)
+
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	So(err, ShouldBeNil)
+	go s.Serve(udpConn)
+	return udpConn.LocalAddr().String(), func() {
+		d.Close()
+		s.Close()
+		udpConn.Close()
+	}
+}
+
+func selfSignedCert() (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	So(err, ShouldBeNil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	So(err, ShouldBeNil)
+	leaf, err := x509.ParseCertificate(der)
+	So(err, ShouldBeNil)
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+type fakeCallback struct {
+	onPacket    chan bool
+	messageType message.MessageType
+	packetType  parser.PacketType
+	body        []byte
+	err         error
+	closedCount int
+	countLocker sync.Mutex
+}
+
+func newFakeCallback() *fakeCallback {
+	return &fakeCallback{
+		onPacket: make(chan bool),
+	}
+}
+
+func (f *fakeCallback) OnPacket(r *parser.PacketDecoder) {
+	f.packetType = r.Type()
+	f.messageType = r.MessageType()
+	f.body, f.err = ioutil.ReadAll(r)
+	f.onPacket <- true
+}
+
+func (f *fakeCallback) OnClose(s transport.Server) {
+	f.countLocker.Lock()
+	defer f.countLocker.Unlock()
+	f.closedCount++
+}
+
+func (f *fakeCallback) ClosedCount() int {
+	f.countLocker.Lock()
+	defer f.countLocker.Unlock()
+	return f.closedCount
+}